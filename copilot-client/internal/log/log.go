@@ -0,0 +1,191 @@
+// Package log provides structured, contextual logging for go-app, mirroring
+// the logging package used on the copilot-proxy side. Callers chain
+// Contexter values onto an event, then emit it at a level; output is either
+// JSON or human-readable depending on the LOG_FORMAT environment variable.
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Level is a logging severity, ordered from most to least verbose.
+type Level int
+
+const (
+	TRACE Level = iota
+	DEBUG
+	INFO
+	WARN
+	ERROR
+)
+
+// String returns the level's name, as used in both log formats.
+func (l Level) String() string {
+	switch l {
+	case TRACE:
+		return "TRACE"
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Contexter lets a domain type (a user, an event, a request) contribute
+// structured fields to a log entry without the logger needing to know its
+// concrete type.
+type Contexter interface {
+	Context() map[string]any
+}
+
+var (
+	mu             sync.Mutex
+	levelOverrides = map[string]Level{}
+	defaultLevel   = INFO
+	format         = formatFromEnv()
+)
+
+func formatFromEnv() string {
+	if os.Getenv("LOG_FORMAT") == "json" {
+		return "json"
+	}
+	return "text"
+}
+
+// SetLevelOverride sets the minimum level emitted for events tagged with
+// tag, e.g. SetLevelOverride("rate_limiter", DEBUG) to get verbose rate
+// limiter logs without turning on DEBUG everywhere else.
+func SetLevelOverride(tag string, level Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	levelOverrides[tag] = level
+}
+
+func levelFor(tag string) Level {
+	mu.Lock()
+	defer mu.Unlock()
+	if level, ok := levelOverrides[tag]; ok {
+		return level
+	}
+	return defaultLevel
+}
+
+// Event accumulates structured fields from one or more Contexters before
+// being emitted at a specific level.
+type Event struct {
+	tag    string
+	fields map[string]any
+	err    error
+}
+
+// Context starts a new Event, merging the fields contributed by each ctxer.
+// Later ctxers win on key collisions.
+func Context(ctxers ...Contexter) *Event {
+	e := &Event{fields: make(map[string]any)}
+	for _, c := range ctxers {
+		if c == nil {
+			continue
+		}
+		for k, v := range c.Context() {
+			e.fields[k] = v
+		}
+	}
+	return e
+}
+
+// Tag scopes the event to a named subsystem (e.g. "rate_limiter") so
+// SetLevelOverride can control its verbosity independently.
+func (e *Event) Tag(tag string) *Event {
+	e.tag = tag
+	return e
+}
+
+// Err attaches an error to the event. Events with an error are emitted even
+// if the call site doesn't explicitly choose Error/Warn.
+func (e *Event) Err(err error) *Event {
+	e.err = err
+	return e
+}
+
+// Trace emits the event at TRACE level.
+func (e *Event) Trace(msg string) { e.emit(TRACE, msg) }
+
+// Debug emits the event at DEBUG level.
+func (e *Event) Debug(msg string) { e.emit(DEBUG, msg) }
+
+// Info emits the event at INFO level.
+func (e *Event) Info(msg string) { e.emit(INFO, msg) }
+
+// Warn emits the event at WARN level.
+func (e *Event) Warn(msg string) { e.emit(WARN, msg) }
+
+// Error emits the event at ERROR level.
+func (e *Event) Error(msg string) { e.emit(ERROR, msg) }
+
+func (e *Event) emit(level Level, msg string) {
+	if level < levelFor(e.tag) {
+		return
+	}
+
+	if format == "json" {
+		e.emitJSON(level, msg)
+		return
+	}
+	e.emitText(level, msg)
+}
+
+func (e *Event) emitJSON(level Level, msg string) {
+	entry := make(map[string]any, len(e.fields)+4)
+	for k, v := range e.fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339)
+	entry["level"] = level.String()
+	entry["message"] = msg
+	if e.tag != "" {
+		entry["tag"] = e.tag
+	}
+	if e.err != nil {
+		entry["error"] = e.err.Error()
+	}
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "log: failed to marshal entry: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(encoded))
+}
+
+func (e *Event) emitText(level Level, msg string) {
+	line := fmt.Sprintf("%s [%s]", time.Now().Format(time.RFC3339), level)
+	if e.tag != "" {
+		line += fmt.Sprintf(" (%s)", e.tag)
+	}
+	line += " " + msg
+
+	keys := make([]string, 0, len(e.fields))
+	for k := range e.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		line += fmt.Sprintf(" %s=%v", k, e.fields[k])
+	}
+	if e.err != nil {
+		line += fmt.Sprintf(" err=%q", e.err.Error())
+	}
+
+	fmt.Fprintln(os.Stdout, line)
+}
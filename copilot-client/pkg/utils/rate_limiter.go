@@ -2,10 +2,16 @@ package utils
 
 import (
 	"fmt"
+	"go-app/internal/log"
+	"hash/fnv"
 	"sync"
 	"time"
 )
 
+// defaultShardCount is the number of independent bucket maps a RateLimiter
+// stripes its keys across, so hot users don't serialize through one lock.
+const defaultShardCount = 32
+
 // RateLimit interface defines methods for rate limiting
 type RateLimit interface {
 	Capacity() int
@@ -52,46 +58,203 @@ type RateBucket struct {
 	lastRefill         time.Time
 }
 
-// RateLimiter is a structure that implements a token bucket algorithm for rate limiting.
+// rateLimiterShard owns a slice of the keyspace behind its own mutex so that
+// unrelated users never contend on the same lock.
+type rateLimiterShard struct {
+	mu      sync.Mutex
+	buckets map[string]*RateBucket
+	dirty   map[string]struct{}
+}
+
+func newRateLimiterShard() *rateLimiterShard {
+	return &rateLimiterShard{
+		buckets: make(map[string]*RateBucket),
+		dirty:   make(map[string]struct{}),
+	}
+}
+
+// RateLimiter is a structure that implements a token bucket algorithm for
+// rate limiting. Buckets live in a striped map of shards, are cached behind
+// an LRU with TTL eviction, and are optionally persisted to a
+// RateLimiterStore by a background queue writer so limits survive restarts.
 type RateLimiter struct {
-	buckets      map[string]*RateBucket
-	dirtyBuckets map[string]struct{}
-	mu           sync.Mutex
+	shards []*rateLimiterShard
+	cache  *lookupCache
+
+	store         RateLimiterStore
+	flushInterval time.Duration
+	stopFlusher   chan struct{}
+	flusherDone   chan struct{}
+}
+
+// RateLimiterConfig controls the optional caching and persistence behavior
+// of a RateLimiter created with NewPersistentRateLimiter.
+type RateLimiterConfig struct {
+	// ShardCount is the number of bucket-map shards. Defaults to 32.
+	ShardCount int
+	// CacheSize is the maximum number of buckets kept warm in the lookup
+	// cache before the least recently used entry is evicted. Defaults to 10000.
+	CacheSize int
+	// CacheTTL is how long an idle bucket stays in the lookup cache before
+	// eviction. Defaults to 10 minutes.
+	CacheTTL time.Duration
+	// FlushInterval is how often dirty buckets are written to the store.
+	// Defaults to 5 seconds.
+	FlushInterval time.Duration
+}
+
+func (c RateLimiterConfig) withDefaults() RateLimiterConfig {
+	if c.ShardCount <= 0 {
+		c.ShardCount = defaultShardCount
+	}
+	if c.CacheSize <= 0 {
+		c.CacheSize = 10000
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = 10 * time.Minute
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 5 * time.Second
+	}
+	return c
 }
 
-// NewRateLimiter creates a new RateLimiter.
+// NewRateLimiter creates a RateLimiter that keeps all buckets in memory with
+// no persistence. Use NewPersistentRateLimiter to survive restarts.
 func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		buckets:      make(map[string]*RateBucket),
-		dirtyBuckets: make(map[string]struct{}),
+	rl, _ := newRateLimiter(nil, RateLimiterConfig{})
+	return rl
+}
+
+// NewPersistentRateLimiter creates a RateLimiter backed by store. Buckets
+// hydrate lazily from the store on first Check, and a background goroutine
+// flushes dirty buckets to the store every cfg.FlushInterval, coalescing any
+// number of updates to a bucket into a single write per interval.
+func NewPersistentRateLimiter(store RateLimiterStore, cfg RateLimiterConfig) *RateLimiter {
+	rl, _ := newRateLimiter(store, cfg)
+	return rl
+}
+
+func newRateLimiter(store RateLimiterStore, cfg RateLimiterConfig) (*RateLimiter, error) {
+	cfg = cfg.withDefaults()
+
+	shards := make([]*rateLimiterShard, cfg.ShardCount)
+	for i := range shards {
+		shards[i] = newRateLimiterShard()
+	}
+
+	rl := &RateLimiter{
+		shards:        shards,
+		cache:         newLookupCache(cfg.CacheSize, cfg.CacheTTL),
+		store:         store,
+		flushInterval: cfg.FlushInterval,
+	}
+
+	if store != nil {
+		rl.stopFlusher = make(chan struct{})
+		rl.flusherDone = make(chan struct{})
+		go rl.runFlusher()
 	}
+
+	return rl, nil
 }
 
-// Check returns an error if the user has exceeded the specified rate limit
-func (rl *RateLimiter) Check(limit RateLimit, userID uint64) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// Close stops the background flush goroutine, if one is running.
+func (rl *RateLimiter) Close() {
+	if rl.stopFlusher == nil {
+		return
+	}
+	close(rl.stopFlusher)
+	<-rl.flusherDone
+}
 
-	// Create bucket key using user ID and limit name
+// Check returns true if the request is allowed under the specified rate
+// limit, hydrating the bucket from the lookup cache or the persistent store
+// on first use.
+func (rl *RateLimiter) Check(limit RateLimit, userID uint64) bool {
 	bucketKey := getBucketKey(userID, limit.DBName())
+	shard := rl.shardFor(bucketKey)
+
+	shard.mu.Lock()
 
-	// Get or create bucket
-	bucket, exists := rl.buckets[bucketKey]
+	bucket, exists := shard.buckets[bucketKey]
 	if !exists {
-		bucket = &RateBucket{
-			capacity:           limit.Capacity(),
-			tokenCount:         limit.Capacity(),
-			refillTimePerToken: limit.RefillDuration() / time.Duration(limit.Capacity()),
-			lastRefill:         time.Now(),
+		bucket = rl.hydrateBucket(bucketKey, limit)
+		shard.buckets[bucketKey] = bucket
+	}
+
+	shard.dirty[bucketKey] = struct{}{}
+	allowed := bucket.Allow(time.Now())
+	shard.mu.Unlock()
+
+	if evicted := rl.cache.touch(bucketKey); evicted != "" {
+		rl.evictBucket(evicted)
+	}
+
+	return allowed
+}
+
+// hydrateBucket loads a bucket's prior state from the store if one exists,
+// otherwise starts it fresh at full capacity.
+func (rl *RateLimiter) hydrateBucket(bucketKey string, limit RateLimit) *RateBucket {
+	if rl.store != nil {
+		if stored, ok, err := rl.store.LoadBucket(bucketKey); err == nil && ok {
+			return &RateBucket{
+				capacity:           limit.Capacity(),
+				tokenCount:         stored.TokenCount,
+				refillTimePerToken: limit.RefillDuration() / time.Duration(limit.Capacity()),
+				lastRefill:         stored.LastRefill,
+			}
 		}
-		rl.buckets[bucketKey] = bucket
 	}
 
-	// Mark bucket as dirty for persistence
-	rl.dirtyBuckets[bucketKey] = struct{}{}
+	return &RateBucket{
+		capacity:           limit.Capacity(),
+		tokenCount:         limit.Capacity(),
+		refillTimePerToken: limit.RefillDuration() / time.Duration(limit.Capacity()),
+		lastRefill:         time.Now(),
+	}
+}
+
+// shardFor picks the shard owning bucketKey using fnv hashing, so the same
+// key always lands on the same shard.
+func (rl *RateLimiter) shardFor(bucketKey string) *rateLimiterShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(bucketKey))
+	return rl.shards[h.Sum32()%uint32(len(rl.shards))]
+}
+
+// evictBucket drops bucketKey's bucket from its shard. Called both when the
+// lookup cache pushes a key out for being over CacheSize and, via evictIdle,
+// when one goes idle past CacheTTL — either way the cache has already
+// decided the bucket is gone, independent of whether a RateLimiterStore is
+// configured to persist it.
+//
+// If the bucket still has a pending dirty write, it's flushed to rl.store
+// first: evictIdle only ever calls this right after flush() has already
+// saved everything dirty, but the CacheSize path in Check can evict a bucket
+// that was marked dirty moments ago and hasn't hit a flush interval yet, and
+// dropping it unflushed would silently lose that write.
+func (rl *RateLimiter) evictBucket(bucketKey string) {
+	shard := rl.shardFor(bucketKey)
 
-	// Check if request can be allowed
-	return bucket.Allow(time.Now())
+	shard.mu.Lock()
+	bucket, wasDirty := shard.buckets[bucketKey], false
+	if _, ok := shard.dirty[bucketKey]; ok {
+		wasDirty = true
+	}
+	delete(shard.buckets, bucketKey)
+	delete(shard.dirty, bucketKey)
+	shard.mu.Unlock()
+
+	if wasDirty && rl.store != nil && bucket != nil {
+		stored := map[string]StoredBucket{
+			bucketKey: {TokenCount: bucket.tokenCount, LastRefill: bucket.lastRefill},
+		}
+		if err := rl.store.SaveBuckets(stored); err != nil {
+			log.Context().Tag("rate_limiter").Err(err).Warn("failed to flush evicted rate limiter bucket to store")
+		}
+	}
 }
 
 // Allow determines whether a request is permitted based on the rate-limiting rules.
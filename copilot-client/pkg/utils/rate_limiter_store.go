@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"container/list"
+	"database/sql"
+	"go-app/internal/log"
+	"sync"
+	"time"
+)
+
+// StoredBucket is the snapshot of a RateBucket's state persisted to a
+// RateLimiterStore between flushes.
+type StoredBucket struct {
+	TokenCount int
+	LastRefill time.Time
+}
+
+// RateLimiterStore persists rate limiter bucket state so it survives process
+// restarts. Implementations are expected to upsert on SaveBuckets.
+type RateLimiterStore interface {
+	// LoadBucket returns the persisted state for bucketKey, if any.
+	LoadBucket(bucketKey string) (bucket StoredBucket, found bool, err error)
+	// SaveBuckets persists the given buckets, keyed by bucket key. Called
+	// periodically by the RateLimiter's queue writer with every bucket that
+	// changed since the last flush.
+	SaveBuckets(buckets map[string]StoredBucket) error
+}
+
+// runFlusher periodically drains dirty buckets from every shard and writes
+// them to the store in one batch, coalescing any number of Check calls made
+// against a bucket during the interval into a single write.
+func (rl *RateLimiter) runFlusher() {
+	defer close(rl.flusherDone)
+
+	ticker := time.NewTicker(rl.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.stopFlusher:
+			rl.flush()
+			return
+		case <-ticker.C:
+			rl.flush()
+		}
+	}
+}
+
+// flush collects every dirty bucket across all shards and writes them to the
+// store in a single call.
+func (rl *RateLimiter) flush() {
+	if rl.store == nil {
+		return
+	}
+
+	dirty := make(map[string]StoredBucket)
+
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+		for bucketKey := range shard.dirty {
+			bucket := shard.buckets[bucketKey]
+			dirty[bucketKey] = StoredBucket{
+				TokenCount: bucket.tokenCount,
+				LastRefill: bucket.lastRefill,
+			}
+		}
+		shard.dirty = make(map[string]struct{})
+		shard.mu.Unlock()
+	}
+
+	if len(dirty) > 0 {
+		if err := rl.store.SaveBuckets(dirty); err != nil {
+			log.Context().Tag("rate_limiter").Err(err).Warn("failed to flush rate limiter buckets to store")
+		}
+	}
+
+	rl.evictIdle()
+}
+
+// evictIdle drops buckets that the lookup cache hasn't seen touched within
+// its TTL, freeing memory for users who've gone quiet.
+func (rl *RateLimiter) evictIdle() {
+	for _, bucketKey := range rl.cache.idle() {
+		rl.evictBucket(bucketKey)
+	}
+}
+
+// lookupCache is an LRU cache of recently-used bucket keys with TTL-based
+// eviction, used to decide when an idle bucket can be dropped from memory.
+type lookupCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+}
+
+type lookupCacheEntry struct {
+	key      string
+	lastUsed time.Time
+}
+
+func newLookupCache(maxSize int, ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// touch marks key as recently used, returning the least recently used key
+// if that pushed the cache over capacity (empty string otherwise). It only
+// evicts its own bookkeeping; the caller is responsible for dropping the
+// evicted key's actual bucket.
+func (c *lookupCache) touch(key string) (evicted string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lookupCacheEntry).lastUsed = time.Now()
+		c.order.MoveToFront(elem)
+		return ""
+	}
+
+	elem := c.order.PushFront(&lookupCacheEntry{key: key, lastUsed: time.Now()})
+	c.entries[key] = elem
+
+	if c.order.Len() > c.maxSize {
+		evicted = c.evictOldest()
+	}
+	return evicted
+}
+
+// idle returns the set of keys that haven't been touched within the TTL and
+// removes them from the cache.
+func (c *lookupCache) idle() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var idleKeys []string
+	cutoff := time.Now().Add(-c.ttl)
+
+	for elem := c.order.Back(); elem != nil; {
+		entry := elem.Value.(*lookupCacheEntry)
+		prev := elem.Prev()
+		if entry.lastUsed.Before(cutoff) {
+			idleKeys = append(idleKeys, entry.key)
+			c.order.Remove(elem)
+			delete(c.entries, entry.key)
+		}
+		elem = prev
+	}
+
+	return idleKeys
+}
+
+// evictOldest removes the least recently used entry from the cache's own
+// bookkeeping and returns its key, or "" if the cache is empty.
+func (c *lookupCache) evictOldest() string {
+	elem := c.order.Back()
+	if elem == nil {
+		return ""
+	}
+	c.order.Remove(elem)
+	key := elem.Value.(*lookupCacheEntry).key
+	delete(c.entries, key)
+	return key
+}
+
+// SQLRateLimiterStore is a RateLimiterStore backed by database/sql, working
+// against either SQLite or Postgres depending on which driver the caller has
+// registered on db. It expects a table of the shape:
+//
+//	CREATE TABLE rate_limiter_buckets (
+//	    bucket_key  TEXT PRIMARY KEY,
+//	    token_count INTEGER NOT NULL,
+//	    last_refill TIMESTAMP NOT NULL
+//	)
+type SQLRateLimiterStore struct {
+	db *sql.DB
+}
+
+// NewSQLRateLimiterStore wraps an already-opened *sql.DB (SQLite or
+// Postgres) as a RateLimiterStore.
+func NewSQLRateLimiterStore(db *sql.DB) *SQLRateLimiterStore {
+	return &SQLRateLimiterStore{db: db}
+}
+
+// LoadBucket returns the persisted state for bucketKey, if any.
+func (s *SQLRateLimiterStore) LoadBucket(bucketKey string) (StoredBucket, bool, error) {
+	row := s.db.QueryRow(
+		`SELECT token_count, last_refill FROM rate_limiter_buckets WHERE bucket_key = ?`,
+		bucketKey,
+	)
+
+	var bucket StoredBucket
+	if err := row.Scan(&bucket.TokenCount, &bucket.LastRefill); err != nil {
+		if err == sql.ErrNoRows {
+			return StoredBucket{}, false, nil
+		}
+		return StoredBucket{}, false, err
+	}
+
+	return bucket, true, nil
+}
+
+// SaveBuckets upserts every bucket in buckets in a single transaction.
+func (s *SQLRateLimiterStore) SaveBuckets(buckets map[string]StoredBucket) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO rate_limiter_buckets (bucket_key, token_count, last_refill)
+		VALUES (?, ?, ?)
+		ON CONFLICT(bucket_key) DO UPDATE SET
+			token_count = excluded.token_count,
+			last_refill = excluded.last_refill
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for bucketKey, bucket := range buckets {
+		if _, err := stmt.Exec(bucketKey, bucket.TokenCount, bucket.LastRefill); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRateLimiterStore is an in-memory RateLimiterStore for tests, recording
+// how many times SaveBuckets was called so tests can assert on coalescing.
+type fakeRateLimiterStore struct {
+	mu        sync.Mutex
+	buckets   map[string]StoredBucket
+	saveCalls int
+}
+
+func newFakeRateLimiterStore() *fakeRateLimiterStore {
+	return &fakeRateLimiterStore{buckets: make(map[string]StoredBucket)}
+}
+
+func (s *fakeRateLimiterStore) LoadBucket(bucketKey string) (StoredBucket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketKey]
+	return bucket, ok, nil
+}
+
+func (s *fakeRateLimiterStore) SaveBuckets(buckets map[string]StoredBucket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveCalls++
+	for key, bucket := range buckets {
+		s.buckets[key] = bucket
+	}
+	return nil
+}
+
+func (s *fakeRateLimiterStore) SaveCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveCalls
+}
+
+func TestRateLimiterPersistsAcrossRestart(t *testing.T) {
+	store := newFakeRateLimiterStore()
+	limit := NewBasicRateLimit(5, time.Minute, "test")
+
+	rl := NewPersistentRateLimiter(store, RateLimiterConfig{FlushInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		if !rl.Check(limit, 42) {
+			t.Fatalf("expected request %d to be allowed against a fresh bucket", i)
+		}
+	}
+	// Close flushes whatever is dirty before the background flusher's own
+	// (much longer) interval would have.
+	rl.Close()
+
+	rl2 := NewPersistentRateLimiter(store, RateLimiterConfig{FlushInterval: time.Hour})
+	defer rl2.Close()
+
+	for i := 0; i < 2; i++ {
+		if !rl2.Check(limit, 42) {
+			t.Fatalf("expected hydrated request %d to be allowed (2 of 5 tokens should remain)", i)
+		}
+	}
+	if rl2.Check(limit, 42) {
+		t.Fatal("expected the rate limiter to deny once the hydrated tokens are exhausted")
+	}
+}
+
+func TestRateLimiterFlusherCoalescesUpdates(t *testing.T) {
+	store := newFakeRateLimiterStore()
+	limit := NewBasicRateLimit(100, time.Minute, "test")
+
+	rl := NewPersistentRateLimiter(store, RateLimiterConfig{FlushInterval: 20 * time.Millisecond})
+	defer rl.Close()
+
+	const checks = 10
+	for i := 0; i < checks; i++ {
+		rl.Check(limit, 7)
+	}
+
+	// Give the flusher a few ticks to run, then confirm it wrote far fewer
+	// times than there were Check calls - i.e. it coalesced the updates
+	// rather than writing on every one.
+	time.Sleep(80 * time.Millisecond)
+
+	saveCalls := store.SaveCalls()
+	if saveCalls == 0 {
+		t.Fatal("expected at least one flush to have run")
+	}
+	if saveCalls >= checks {
+		t.Fatalf("expected far fewer than %d SaveBuckets calls for %d Check calls, got %d", checks, checks, saveCalls)
+	}
+
+	bucket, ok, err := store.LoadBucket(getBucketKey(7, "test"))
+	if err != nil || !ok {
+		t.Fatalf("expected bucket to have been flushed to the store: ok=%v err=%v", ok, err)
+	}
+	if bucket.TokenCount != 100-checks {
+		t.Fatalf("expected %d tokens remaining after %d checks, got %d", 100-checks, checks, bucket.TokenCount)
+	}
+}
+
+func TestEvictOldestDropsBucketFromItsShard(t *testing.T) {
+	rl := NewPersistentRateLimiter(nil, RateLimiterConfig{CacheSize: 1})
+	limit := NewBasicRateLimit(5, time.Minute, "test")
+
+	rl.Check(limit, 1)
+	bucketKey := getBucketKey(1, "test")
+	shard := rl.shardFor(bucketKey)
+	if _, exists := shard.buckets[bucketKey]; !exists {
+		t.Fatal("expected user 1's bucket to exist after its first Check")
+	}
+
+	// CacheSize is 1, so touching a second key evicts user 1's bucket from
+	// the lookup cache - and, per the chunk0-3 eviction fix, from its shard
+	// too, independent of whether a store is configured.
+	rl.Check(limit, 2)
+
+	if _, exists := shard.buckets[bucketKey]; exists {
+		t.Fatal("expected user 1's bucket to have been evicted from its shard, not just from the lookup cache")
+	}
+}
+
+func TestEvictBucketFlushesDirtyStateBeforeDropping(t *testing.T) {
+	store := newFakeRateLimiterStore()
+	rl := NewPersistentRateLimiter(store, RateLimiterConfig{CacheSize: 1, FlushInterval: time.Hour})
+	defer rl.Close()
+
+	limit := NewBasicRateLimit(5, time.Minute, "test")
+
+	// One Check against user 1 leaves its bucket dirty and un-flushed (the
+	// background flusher won't run for an hour).
+	rl.Check(limit, 1)
+
+	// Touching a second key evicts user 1's bucket from the lookup cache
+	// (CacheSize is 1), and per the chunk0-3 eviction fix that must flush
+	// user 1's dirty bucket to the store before dropping it.
+	rl.Check(limit, 2)
+
+	bucketKey := getBucketKey(1, "test")
+	bucket, ok, err := store.LoadBucket(bucketKey)
+	if err != nil {
+		t.Fatalf("LoadBucket: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected user 1's bucket to have been flushed to the store on eviction, not dropped unsaved")
+	}
+	if bucket.TokenCount != 4 {
+		t.Fatalf("expected the flushed bucket to reflect the single Check (4 tokens remaining), got %d", bucket.TokenCount)
+	}
+}
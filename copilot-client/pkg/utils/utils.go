@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 )
 
 // CopilotChatCompletionURL is the endpoint for GitHub Copilot chat completions.
@@ -25,7 +29,9 @@ func SomeUtilityFunction(input string) string {
 
 // CallOpenAIEndpoint sends a request to the OpenAI endpoint and returns the response.
 // This function uses the GitHub Copilot endpoint but formats the request and response
-// in a way that's compatible with OpenAI's API structure.
+// in a way that's compatible with OpenAI's API structure. It's hardcoded to Copilot
+// despite the name; the llm.Provider registry in copilot-proxy/internal/llm is where
+// new backends (Anthropic, Cohere, Google, ...) are added as adapters instead.
 //
 // Parameters:
 //   - apiKey: The API key to use for authentication
@@ -112,6 +118,166 @@ func CallOpenAIEndpoint(apiKey string, payload map[string]interface{}) (map[stri
 	return responseMap, nil
 }
 
+// ChatCompletionChunk is a single Server-Sent Events frame from a streaming
+// chat completion, matching OpenAI's "stream: true" response shape.
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	// Usage is only populated on the final chunk, and only when the request
+	// set stream_options.include_usage.
+	Usage *ChatCompletionUsage `json:"usage,omitempty"`
+}
+
+// ChatCompletionChunkChoice is one choice within a ChatCompletionChunk.
+type ChatCompletionChunkChoice struct {
+	Delta        ChatCompletionDelta `json:"delta"`
+	FinishReason string              `json:"finish_reason"`
+	Index        int                 `json:"index"`
+}
+
+// ChatCompletionDelta carries the incremental content a streaming choice
+// adds in a given chunk. Role is only set on the first chunk of a choice;
+// Content may be empty on the final chunk, which instead carries
+// FinishReason.
+type ChatCompletionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ChatCompletionUsage is the token accounting for a completed request.
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// CallOpenAIEndpointStream sends a "stream: true" request to the GitHub
+// Copilot endpoint and decodes each Server-Sent Events frame into a
+// ChatCompletionChunk as it arrives, rather than buffering the full
+// response. This preserves chunk boundaries for callers rendering incremental
+// output (e.g. an editor's chat UI) instead of waiting for the full
+// completion.
+//
+// Parameters:
+//   - apiKey: The API key to use for authentication
+//   - payload: The request payload (must include "model" and "messages" fields;
+//     "stream" is set to true automatically)
+//
+// Returns a channel of ChatCompletionChunk that is closed once the server
+// sends the terminal "data: [DONE]" marker or the connection ends, or an
+// error if the request itself could not be started. Errors encountered while
+// reading the stream after it has started are not surfaced on the channel;
+// the channel is simply closed early.
+//
+// Example:
+//
+//	chunks, err := CallOpenAIEndpointStream(apiKey, payload)
+//	if err != nil {
+//	    return err
+//	}
+//	for chunk := range chunks {
+//	    for _, choice := range chunk.Choices {
+//	        fmt.Print(choice.Delta.Content)
+//	    }
+//	}
+func CallOpenAIEndpointStream(apiKey string, payload map[string]interface{}) (<-chan ChatCompletionChunk, error) {
+	// Ensure payload adheres to OpenAI schema
+	if _, ok := payload["model"]; !ok {
+		return nil, errors.New("payload must include 'model'")
+	}
+	if _, ok := payload["messages"]; !ok {
+		return nil, errors.New("payload must include 'messages'")
+	}
+
+	payload["stream"] = true
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", CopilotChatCompletionURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to call OpenAI endpoint: %s: %s", resp.Status, string(respBody))
+	}
+
+	chunks := make(chan ChatCompletionChunk)
+	go streamChatCompletionChunks(resp.Body, chunks)
+	return chunks, nil
+}
+
+// streamChatCompletionChunks reads body line by line, decoding each "data:
+// {...}" SSE frame into a ChatCompletionChunk and sending it on chunks. It
+// stops at the terminal "data: [DONE]" marker or when body reaches EOF,
+// closing chunks and body in either case.
+func streamChatCompletionChunks(body io.ReadCloser, chunks chan<- ChatCompletionChunk) {
+	defer close(chunks)
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		chunks <- chunk
+	}
+}
+
+// CallOpenAIEndpointStreamTo is like CallOpenAIEndpointStream, but forwards
+// the raw "data: {...}" SSE frames to w as they arrive instead of decoding
+// them, for callers (such as a reverse proxy) that only need to pass the
+// stream through to another SSE client byte-for-byte. It blocks until the
+// stream ends, returning any error encountered reading the response or
+// writing to w.
+func CallOpenAIEndpointStreamTo(apiKey string, payload map[string]interface{}, w io.Writer) error {
+	chunks, err := CallOpenAIEndpointStream(apiKey, payload)
+	if err != nil {
+		return err
+	}
+
+	for chunk := range chunks {
+		encoded, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", encoded); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "data: [DONE]\n\n")
+	return err
+}
+
 // CallCopilotEndpoint sends a request to the GitHub Copilot endpoint using the locally stored token.
 // This is a convenience wrapper around CallOpenAIEndpoint that automatically fetches and uses
 // the local Copilot token.
@@ -5,9 +5,9 @@ import (
 	"copilot-proxy/internal"
 	"copilot-proxy/internal/app"
 	"copilot-proxy/internal/auth"
+	"copilot-proxy/internal/auth/copilot"
 	"copilot-proxy/internal/llm"
 	"copilot-proxy/internal/rpc"
-	"copilot-proxy/pkg/utils"
 	"log"
 	"net/http"
 	"os"
@@ -33,19 +33,39 @@ func main() {
 	// Initialize connection pool for RPC
 	_ = rpc.NewConnectionPool() // Discard the unused connection pool
 
-	// Initialize the authentication service
-	_ = auth.NewService()
-
-	// Initialize app
+	// Initialize app; this also builds its own auth.Service from
+	// AUTH_CONNECTORS, wired up below once llmCore exists.
 	a := app.NewApp()
 
-	// Check for GitHub Copilot token in local config if not in environment
-	if os.Getenv("COPILOT_API_KEY") == "" {
-		if token, err := utils.GetCopilotToken(); err == nil {
-			os.Setenv("COPILOT_API_KEY", token)
-			log.Printf("Retrieved GitHub Copilot token from local configuration")
+	// Exchange a local GitHub Copilot client's OAuth token (from apps.json)
+	// for a refreshing short-lived Chat API key, if COPILOT_API_KEY isn't
+	// already set and the device flow cache below isn't configured to
+	// handle it instead. The raw apps.json OAuth token isn't itself a valid
+	// Chat API key; it must go through the copilot_internal/v2/token
+	// exchange first.
+	if os.Getenv("COPILOT_API_KEY") == "" && os.Getenv("COPILOT_TOKEN_STORE_PATH") == "" {
+		appsJSONCache := copilot.NewInMemoryCache()
+		if err := appsJSONCache.LoadFromAppsJSON(ctx); err != nil {
+			log.Printf("Could not retrieve GitHub Copilot token from local configuration: %v", err)
 		} else {
-			log.Printf("Could not retrieve GitHub Copilot token: %v", err)
+			llm.SetCopilotTokenSource(appsJSONCache.Token)
+			log.Printf("Exchanged local GitHub Copilot token for a refreshing Copilot Chat API key")
+		}
+	}
+
+	// Set up the Copilot OAuth device flow when a store path is configured,
+	// so the server keeps a short-lived Copilot API key fresh on its own
+	// instead of relying solely on the static COPILOT_API_KEY above.
+	if storePath := os.Getenv("COPILOT_TOKEN_STORE_PATH"); storePath != "" {
+		copilotCache, err := copilot.NewCache(storePath)
+		if err != nil {
+			log.Printf("Failed to initialize Copilot OAuth token cache: %v", err)
+		} else {
+			if err := copilotCache.LoadAndRefresh(ctx); err != nil {
+				log.Printf("No stored Copilot OAuth token yet, visit /auth/copilot/device to log in: %v", err)
+			}
+			llm.SetCopilotTokenSource(copilotCache.Token)
+			a.Router.HandleFunc("/auth/copilot/device", copilot.DeviceLoginHandler(copilotCache))
 		}
 	}
 
@@ -63,24 +83,66 @@ func main() {
 		if err != nil {
 			log.Printf("Failed to initialize Stripe billing: %v", err)
 		} else {
-			if err := stripeBilling.Initialize(); err != nil {
+			if err := stripeBilling.Initialize(ctx); err != nil {
 				log.Printf("Failed to initialize Stripe meters and prices: %v", err)
 			}
 		}
 	}
 
-	// Initialize LLM server
-	llmSecret := os.Getenv("LLM_API_SECRET")
-	if llmSecret != "" {
-		llmState := llm.NewLLMServerState(llmSecret)
-		// Register LLM handlers
-		llmState.RegisterHandlers(a.Router)
+	// Initialize LLM server. RS256 with a rotating JWKS-published key set is
+	// the default; LLM_JWT_LEGACY_HS256 stays available for rolling upgrades
+	// where not every verifier has switched to the JWKS endpoint yet.
+	var llmCore *llm.Core
+	if os.Getenv("LLM_JWT_LEGACY_HS256") == "true" {
+		if llmSecret := os.Getenv("LLM_API_SECRET"); llmSecret != "" {
+			llmCore = llm.NewCore(llmSecret, nil, nil)
+		}
+	} else {
+		rotationInterval := 24 * time.Hour
+		if v := os.Getenv("LLM_JWT_ROTATION_INTERVAL"); v != "" {
+			if d, err := time.ParseDuration(v); err == nil {
+				rotationInterval = d
+			}
+		}
+
+		keys, err := llm.NewKeyManager(rotationInterval, os.Getenv("LLM_JWT_KEYS_PATH"))
+		if err != nil {
+			log.Fatalf("Failed to initialize JWT key manager: %v", err)
+		}
+		llmCore = llm.NewCoreWithKeys(keys, nil, nil)
+	}
+
+	if llmCore != nil {
+		// Register public LLM handlers; admin handlers are only wired up
+		// when a separate admin key is configured.
+		llm.NewPublicHandler(llmCore).RegisterHandlers(a.Router)
+		llm.NewOpenAIHandler(llmCore).RegisterHandlers(a.Router)
+		if llmCore.Keys != nil {
+			llm.NewJWKSHandler(llmCore.Keys).RegisterHandlers(a.Router)
+		}
+		if adminKey := os.Getenv("LLM_ADMIN_API_KEY"); adminKey != "" {
+			llm.NewAdminHandler(llmCore, adminKey).RegisterHandlers(a.Router)
+		}
+
+		llm.RegisterMetricsHandler(a.Router)
 
 		// Log available LLM providers
 		config := llm.GetConfig()
 		for _, provider := range config.EnabledProviders {
 			log.Printf("Enabled LLM provider: %s", provider)
 		}
+
+		// Mint LLM tokens from verified connector identities, so a
+		// successful /auth/{connector}/callback results in a token signed
+		// the same way as every other LLM token.
+		a.Auth.TokenMinter = func(identity auth.Identity) (string, error) {
+			if llmCore.Keys != nil {
+				return llm.CreateLLMToken(identity.StableUserID(), identity.Subject, identity.PreferredUsername,
+					identity.AccountCreatedAt, false, false, 0, nil, llmCore.Keys)
+			}
+			return llm.CreateLLMTokenLegacy(identity.StableUserID(), identity.Subject, identity.PreferredUsername,
+				identity.AccountCreatedAt, false, false, 0, nil, llmCore.Secret)
+		}
 	}
 
 	// Authenticate and retrieve API key using OAuth token
@@ -1,9 +1,11 @@
 package app
 
 import (
+	"context"
 	"copilot-proxy/internal/auth"
 	"copilot-proxy/pkg/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -31,6 +33,14 @@ func (a *App) initializeRoutes() {
 	a.Router.HandleFunc("/authenticate", a.handleAuthenticate)
 	a.Router.HandleFunc("/stream", a.handleStream)
 	a.Router.HandleFunc("/openai", a.handleOpenAI)
+
+	// Register /auth/{name}/login and /auth/{name}/callback for every
+	// connector AUTH_CONNECTORS configured, so adding an SSO provider is a
+	// config change rather than a new handler.
+	for _, connector := range a.Auth.Connectors() {
+		a.Router.HandleFunc("/auth/"+connector.Name()+"/login", a.handleConnectorLogin(connector))
+		a.Router.HandleFunc("/auth/"+connector.Name()+"/callback", a.handleConnectorCallback(connector))
+	}
 }
 
 func (a *App) handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -48,6 +58,53 @@ func (a *App) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Authenticated successfully"))
 }
 
+// handleConnectorLogin redirects the user to connector's login URL, first
+// minting a state token so the callback can confirm it's completing the
+// same login.
+func (a *App) handleConnectorLogin(connector auth.Connector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := a.Auth.NewLoginState(connector.Name())
+		if err != nil {
+			http.Error(w, "failed to start login", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, connector.LoginURL(state), http.StatusFound)
+	}
+}
+
+// handleConnectorCallback verifies the login's state, exchanges the
+// authorization code for a verified Identity, and mints an LLM access token
+// from it via a.Auth.TokenMinter.
+func (a *App) handleConnectorCallback(connector auth.Connector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := r.URL.Query().Get("state")
+		if err := a.Auth.ConsumeLoginState(connector.Name(), state); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		identity, err := connector.HandleCallback(r.Context(), r.URL.Query().Get("code"), state)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if a.Auth.TokenMinter == nil {
+			http.Error(w, "no token minter configured", http.StatusInternalServerError)
+			return
+		}
+
+		token, err := a.Auth.TokenMinter(identity)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to mint LLM token: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}
+}
+
 func (a *App) handleStream(w http.ResponseWriter, r *http.Request) {
 	limiter := utils.NewRateLimiter()
 	// Define a custom rate limit for stream requests
@@ -95,33 +152,18 @@ func (a *App) handleOpenAI(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetAPIKey retrieves an API key using the provided OAuth token.
+// GetAPIKey exchanges an OAuth refresh token for an LLM access token,
+// trying it against every configured connector and minting the token from
+// whichever one accepts it.
 func (a *App) GetAPIKey(oauthToken string) (string, error) {
-	req, err := http.NewRequest("GET", "https://example.com/api/get_llm_api_token", nil)
+	identity, err := a.Auth.RefreshAny(context.Background(), oauthToken)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to retrieve identity for OAuth token: %w", err)
 	}
 
-	// Add the OAuth token to the Authorization header
-	req.Header.Set("Authorization", "Bearer "+oauthToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to retrieve API key: %s", resp.Status)
-	}
-
-	var response struct {
-		Token string `json:"token"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
+	if a.Auth.TokenMinter == nil {
+		return "", errors.New("no token minter configured")
 	}
 
-	return response.Token, nil
+	return a.Auth.TokenMinter(identity)
 }
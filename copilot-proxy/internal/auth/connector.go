@@ -0,0 +1,64 @@
+// Package auth lets this proxy authenticate end users through pluggable
+// identity connectors - GitHub OAuth, generic OIDC, or a static API key for
+// CI - rather than one hard-coded login flow. Service owns the set of
+// configured connectors; App registers /auth/{connector}/login and
+// /auth/{connector}/callback for each of them. See internal/auth/copilot
+// for the separate, unrelated flow the server uses to authenticate itself
+// to GitHub Copilot.
+package auth
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+)
+
+// Identity is what a Connector hands back after a successful login,
+// refresh, or key check - an external identity, not yet tied to any
+// particular user record in this system.
+type Identity struct {
+	// Connector is the Name() of the Connector that produced this Identity.
+	Connector string
+	// Subject is the connector's stable identifier for this identity (an
+	// OIDC "sub" claim, or a GitHub user id).
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Name              string
+	AccountCreatedAt  time.Time
+	// RefreshToken is set when the connector issues one, for later calls to
+	// Refresh.
+	RefreshToken string
+}
+
+// StableUserID derives a uint64 user id from the identity's connector and
+// subject. A real deployment would instead look up, or create, a user
+// record keyed by connector+subject and return its database id; this
+// stands in for that table until it exists.
+func (i Identity) StableUserID() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(i.Connector))
+	h.Write([]byte("|"))
+	h.Write([]byte(i.Subject))
+	return h.Sum64()
+}
+
+// Connector is a pluggable identity provider: a login flow that ends in a
+// verified Identity, without Service or App needing to know whether it's
+// talking to GitHub, an OIDC provider, or a CI static key.
+type Connector interface {
+	// Name identifies the connector in routes: /auth/{name}/login and
+	// /auth/{name}/callback.
+	Name() string
+	// LoginURL returns the URL to send the user to, embedding state so the
+	// callback can be correlated with (and verified against) this login.
+	LoginURL(state string) string
+	// HandleCallback exchanges an authorization code for a verified
+	// Identity. state is whatever LoginURL was given for this login;
+	// connectors that need it for replay protection (e.g. deriving a nonce)
+	// can do so here.
+	HandleCallback(ctx context.Context, code string, state string) (Identity, error)
+	// Refresh exchanges a refresh token for a fresh Identity. Connectors
+	// that don't support refreshing return an error.
+	Refresh(ctx context.Context, refreshToken string) (Identity, error)
+}
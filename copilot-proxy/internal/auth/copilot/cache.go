@@ -0,0 +1,364 @@
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"copilot-proxy/internal/log"
+	"copilot-proxy/pkg/utils"
+)
+
+const (
+	apiKeyURL = "https://api.github.com/copilot_internal/v2/token"
+
+	// refreshMargin is how long before expiry the cached API key is refreshed.
+	refreshMargin = time.Minute
+
+	// The following identify this client to GitHub's Copilot endpoints, which
+	// reject requests that don't look like they came from a recognized
+	// editor integration.
+	editorVersion        = "vscode/1.85.0"
+	editorPluginVersion  = "copilot-chat/0.12.0"
+	copilotIntegrationID = "vscode-chat"
+	copilotUserAgent     = "GithubCopilot/1.155.0"
+)
+
+// setCopilotHeaders sets the headers GitHub's Copilot endpoints (both the
+// token exchange and chat completions) require to identify the caller as a
+// recognized Copilot client.
+func setCopilotHeaders(req *http.Request) {
+	req.Header.Set("Editor-Version", editorVersion)
+	req.Header.Set("Editor-Plugin-Version", editorPluginVersion)
+	req.Header.Set("Copilot-Integration-Id", copilotIntegrationID)
+	req.Header.Set("User-Agent", copilotUserAgent)
+}
+
+// APIKey is a short-lived GitHub Copilot Chat API key, as returned by the
+// copilot_internal/v2/token exchange.
+type APIKey struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Cache holds the long-lived GitHub OAuth token obtained via the device
+// code flow (encrypted at rest by a tokenStore) and the short-lived Copilot
+// API key exchanged from it, refreshing the latter in the background a
+// minute before it expires so callers always see a usable key.
+type Cache struct {
+	client *http.Client
+	store  *tokenStore
+
+	mu         sync.RWMutex
+	oauthToken string
+	apiKey     APIKey
+
+	refreshOnce sync.Once
+	started     bool
+	stop        chan struct{}
+	done        chan struct{}
+
+	// refreshMu serializes on-demand refreshes triggered by EnsureFreshToken,
+	// so a burst of requests arriving around expiry coalesces onto a single
+	// token exchange instead of each starting its own.
+	refreshMu sync.Mutex
+}
+
+// NewCache creates a Cache whose long-lived OAuth token is persisted,
+// encrypted, at storePath. It performs no network calls itself; call Login
+// to run the device flow, or LoadAndRefresh to resume from a prior Login.
+func NewCache(storePath string) (*Cache, error) {
+	store, err := newTokenStore(storePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		client: &http.Client{Timeout: 15 * time.Second},
+		store:  store,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// NewInMemoryCache creates a Cache that exchanges and refreshes a Copilot
+// API key entirely in memory, without persisting the long-lived OAuth token
+// anywhere. Suitable for LoadFromAppsJSON, where the OAuth token already
+// lives on disk in an official client's apps.json and doesn't need a second
+// copy.
+func NewInMemoryCache() *Cache {
+	return &Cache{
+		client: &http.Client{Timeout: 15 * time.Second},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// APIKey returns the current cached Copilot API key. ok is false if no key
+// has been obtained yet.
+func (c *Cache) APIKey() (APIKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.apiKey, c.apiKey.Token != ""
+}
+
+// Token returns the current API key's token, or "" if none has been
+// obtained yet. It's the shape SetCopilotTokenSource wants.
+func (c *Cache) Token() (string, bool) {
+	key, ok := c.APIKey()
+	return key.Token, ok
+}
+
+// LoadAndRefresh loads a previously stored OAuth token and starts the
+// background refresh loop. Returns an error if no token has been stored yet
+// (call Login first).
+func (c *Cache) LoadAndRefresh(ctx context.Context) error {
+	token, err := c.store.load()
+	if err != nil {
+		return fmt.Errorf("loading stored Copilot OAuth token: %w", err)
+	}
+
+	c.mu.Lock()
+	c.oauthToken = token
+	c.mu.Unlock()
+
+	if err := c.refreshAPIKey(ctx); err != nil {
+		return err
+	}
+
+	c.startRefresh()
+	return nil
+}
+
+// LoadFromAppsJSON seeds the cache from the OAuth token in the local
+// apps.json used by official GitHub Copilot clients (via
+// utils.GetCopilotToken), persists it to this Cache's own store if one is
+// configured, and starts the background refresh loop. This lets an operator
+// who's already signed in with an official Copilot client (VS Code, Neovim,
+// ...) use this server as a drop-in gateway without also running the device
+// code flow here.
+func (c *Cache) LoadFromAppsJSON(ctx context.Context) error {
+	oauthToken, err := utils.GetCopilotToken()
+	if err != nil {
+		return fmt.Errorf("reading Copilot OAuth token from apps.json: %w", err)
+	}
+
+	if c.store != nil {
+		if err := c.store.save(oauthToken); err != nil {
+			log.Context().Tag("copilot_auth").Err(err).Warn("failed to persist Copilot OAuth token")
+		}
+	}
+
+	c.mu.Lock()
+	c.oauthToken = oauthToken
+	c.mu.Unlock()
+
+	if err := c.refreshAPIKey(ctx); err != nil {
+		return err
+	}
+
+	c.startRefresh()
+	return nil
+}
+
+// EnsureFreshToken returns a Copilot API key that's guaranteed not to be
+// within refreshMargin of expiry, exchanging a fresh one on demand if
+// needed. Callers that already rely on the background refresh loop (started
+// by Login or LoadAndRefresh) don't need this; it exists for callers on the
+// request path who want a correctness guarantee independent of whether that
+// loop is running.
+func (c *Cache) EnsureFreshToken(ctx context.Context) (string, error) {
+	if c.isFresh() {
+		key, _ := c.APIKey()
+		return key.Token, nil
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another goroutine may have refreshed while we waited for refreshMu.
+	if c.isFresh() {
+		key, _ := c.APIKey()
+		return key.Token, nil
+	}
+
+	if err := c.refreshAPIKey(ctx); err != nil {
+		return "", err
+	}
+
+	key, _ := c.APIKey()
+	return key.Token, nil
+}
+
+func (c *Cache) isFresh() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.apiKey.Token != "" && time.Until(c.apiKey.ExpiresAt) > refreshMargin
+}
+
+// Login runs the device code flow end to end: requesting a device code,
+// logging it for the operator, polling until GitHub issues a long-lived
+// OAuth token, then persisting it and starting the background refresh loop.
+func (c *Cache) Login(ctx context.Context) error {
+	device, err := requestDeviceCode(ctx, c.client)
+	if err != nil {
+		return err
+	}
+
+	logDeviceCode(device)
+
+	return c.completeDeviceLogin(ctx, device)
+}
+
+func (c *Cache) completeDeviceLogin(ctx context.Context, device *DeviceCodeResponse) error {
+	oauthToken, err := pollForAccessToken(ctx, c.client, device)
+	if err != nil {
+		return fmt.Errorf("completing Copilot device login: %w", err)
+	}
+
+	if err := c.store.save(oauthToken); err != nil {
+		log.Context().Tag("copilot_auth").Err(err).Warn("failed to persist Copilot OAuth token")
+	}
+
+	c.mu.Lock()
+	c.oauthToken = oauthToken
+	c.mu.Unlock()
+
+	if err := c.refreshAPIKey(ctx); err != nil {
+		return err
+	}
+
+	c.startRefresh()
+	return nil
+}
+
+func logDeviceCode(device *DeviceCodeResponse) {
+	log.Context().Tag("copilot_auth").Info(fmt.Sprintf(
+		"to authorize this server with GitHub Copilot, visit %s and enter code %s",
+		device.VerificationURI, device.UserCode))
+}
+
+// copilotTokenResponse is the copilot_internal/v2/token exchange response.
+type copilotTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// refreshAPIKey exchanges the cached OAuth token for a fresh Copilot API key.
+func (c *Cache) refreshAPIKey(ctx context.Context) error {
+	c.mu.RLock()
+	oauthToken := c.oauthToken
+	c.mu.RUnlock()
+
+	if oauthToken == "" {
+		return errors.New("no Copilot OAuth token available; call Login first")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiKeyURL, nil)
+	if err != nil {
+		return fmt.Errorf("building Copilot token exchange request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+oauthToken)
+	setCopilotHeaders(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("exchanging Copilot OAuth token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Copilot token exchange returned status %d", resp.StatusCode)
+	}
+
+	var out copilotTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("decoding Copilot token exchange response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.apiKey = APIKey{Token: out.Token, ExpiresAt: time.Unix(out.ExpiresAt, 0)}
+	c.mu.Unlock()
+
+	return nil
+}
+
+// runRefresh re-exchanges the OAuth token for a new API key shortly before
+// the current one expires, until Close is called.
+func (c *Cache) runRefresh() {
+	defer close(c.done)
+
+	for {
+		c.mu.RLock()
+		wait := time.Until(c.apiKey.ExpiresAt.Add(-refreshMargin))
+		c.mu.RUnlock()
+
+		if wait < 0 {
+			wait = 0
+		}
+
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(wait):
+			if err := c.refreshAPIKey(context.Background()); err != nil {
+				log.Context().Tag("copilot_auth").Err(err).Warn("failed to refresh Copilot API key")
+			}
+		}
+	}
+}
+
+// startRefresh starts the background refresh loop, if it isn't already
+// running. Safe to call more than once (e.g. from both Login and a later
+// retry); only the first call takes effect.
+func (c *Cache) startRefresh() {
+	c.refreshOnce.Do(func() {
+		c.mu.Lock()
+		c.started = true
+		c.mu.Unlock()
+		go c.runRefresh()
+	})
+}
+
+// Close stops the background refresh loop, if one was started.
+func (c *Cache) Close() {
+	close(c.stop)
+
+	c.mu.RLock()
+	started := c.started
+	c.mu.RUnlock()
+
+	if started {
+		<-c.done
+	}
+}
+
+// DeviceLoginHandler serves the device code step of the login flow over
+// HTTP, for operators who'd rather read the code from a dashboard than
+// server logs. It returns the same JSON GitHub's device code endpoint
+// returns, and continues the flow in the background once the operator has
+// the code in hand.
+func DeviceLoginHandler(cache *Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, err := requestDeviceCode(r.Context(), cache.client)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logDeviceCode(device)
+
+		go func() {
+			if err := cache.completeDeviceLogin(context.Background(), device); err != nil {
+				log.Context().Tag("copilot_auth").Err(err).Warn("Copilot device login did not complete")
+			}
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(device)
+	}
+}
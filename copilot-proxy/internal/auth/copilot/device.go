@@ -0,0 +1,137 @@
+// Package copilot implements the GitHub Copilot device code login flow:
+// trading a one-time device code for a long-lived GitHub OAuth token, then
+// exchanging that for the short-lived API key Copilot Chat actually accepts.
+// See Cache for the refreshing key this package ultimately produces.
+package copilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// copilotClientID is the OAuth client id GitHub Copilot clients use to
+	// start the device code flow.
+	copilotClientID = "Iv1.b507a08c87ecfe98"
+	deviceCodeScope = "read:user"
+
+	deviceCodeURL  = "https://github.com/login/device/code"
+	accessTokenURL = "https://github.com/login/oauth/access_token"
+)
+
+// DeviceCodeResponse is GitHub's response to a device code request. UserCode
+// and VerificationURI are shown to the operator so they can complete the
+// login in a browser; DeviceCode and Interval drive the subsequent poll.
+type DeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// requestDeviceCode starts the device code flow.
+func requestDeviceCode(ctx context.Context, client *http.Client) (*DeviceCodeResponse, error) {
+	form := url.Values{}
+	form.Set("client_id", copilotClientID)
+	form.Set("scope", deviceCodeScope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, deviceCodeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("building device code request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting device code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device code request returned status %d", resp.StatusCode)
+	}
+
+	var out DeviceCodeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding device code response: %w", err)
+	}
+
+	return &out, nil
+}
+
+// accessTokenResponse is GitHub's response to an access token poll. Error is
+// "authorization_pending" or "slow_down" while the operator hasn't finished
+// logging in yet, and any other value means the flow failed outright.
+type accessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+}
+
+// pollForAccessToken polls GitHub at device's interval until the operator
+// completes the login in a browser, returning the resulting long-lived
+// GitHub OAuth token.
+func pollForAccessToken(ctx context.Context, client *http.Client, device *DeviceCodeResponse) (string, error) {
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+
+	for {
+		if time.Now().After(deadline) {
+			return "", errors.New("device code expired before login was completed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		form := url.Values{}
+		form.Set("client_id", copilotClientID)
+		form.Set("device_code", device.DeviceCode)
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, accessTokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", fmt.Errorf("building access token request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("polling for access token: %w", err)
+		}
+
+		var out accessTokenResponse
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("decoding access token response: %w", err)
+		}
+
+		switch out.Error {
+		case "":
+			if out.AccessToken != "" {
+				return out.AccessToken, nil
+			}
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", fmt.Errorf("device login failed: %s", out.Error)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package copilot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// tokenStore persists the long-lived GitHub OAuth token encrypted at rest
+// with AES-256-GCM. The key comes from COPILOT_TOKEN_ENCRYPTION_KEY rather
+// than the RSA keypair copilot-client/internal/auth uses for its own
+// encrypted-at-rest secrets, since that package lives in a separate module
+// this one can't import.
+type tokenStore struct {
+	path string
+	key  []byte
+}
+
+// newTokenStore creates a tokenStore writing to path, keyed by the 32-byte,
+// hex-encoded key in COPILOT_TOKEN_ENCRYPTION_KEY.
+func newTokenStore(path string) (*tokenStore, error) {
+	keyHex := os.Getenv("COPILOT_TOKEN_ENCRYPTION_KEY")
+	if keyHex == "" {
+		return nil, errors.New("COPILOT_TOKEN_ENCRYPTION_KEY must be set to a 32-byte hex key to store the Copilot OAuth token at rest")
+	}
+
+	key, err := hex.DecodeString(keyHex)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("COPILOT_TOKEN_ENCRYPTION_KEY must be 32 bytes, hex-encoded")
+	}
+
+	return &tokenStore{path: path, key: key}, nil
+}
+
+// save encrypts token and writes it to s.path, replacing any previous value.
+func (s *tokenStore) save(token string) error {
+	gcm, err := s.gcm()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("generating nonce: %w", err)
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(token), nil)
+	return os.WriteFile(s.path, []byte(base64.StdEncoding.EncodeToString(ciphertext)), 0o600)
+}
+
+// load decrypts and returns the token previously written by save.
+func (s *tokenStore) load() (string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return "", fmt.Errorf("decoding stored token: %w", err)
+	}
+
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("stored token is corrupt")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting stored token: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func (s *tokenStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
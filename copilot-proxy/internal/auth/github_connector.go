@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	githubAuthorizeURL   = "https://github.com/login/oauth/authorize"
+	githubAccessTokenURL = "https://github.com/login/oauth/access_token"
+	githubUserURL        = "https://api.github.com/user"
+)
+
+// GitHubConnector authenticates users through GitHub's OAuth web flow.
+type GitHubConnector struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	httpClient   *http.Client
+}
+
+// newGitHubConnectorFromEnv builds a GitHubConnector from
+// GITHUB_OAUTH_CLIENT_ID, GITHUB_OAUTH_CLIENT_SECRET, and
+// GITHUB_OAUTH_REDIRECT_URL, all of which are required.
+func newGitHubConnectorFromEnv() (*GitHubConnector, error) {
+	clientID := os.Getenv("GITHUB_OAUTH_CLIENT_ID")
+	clientSecret := os.Getenv("GITHUB_OAUTH_CLIENT_SECRET")
+	redirectURL := os.Getenv("GITHUB_OAUTH_REDIRECT_URL")
+
+	if clientID == "" || clientSecret == "" || redirectURL == "" {
+		return nil, errors.New("GITHUB_OAUTH_CLIENT_ID, GITHUB_OAUTH_CLIENT_SECRET, and GITHUB_OAUTH_REDIRECT_URL are required")
+	}
+
+	return &GitHubConnector{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		httpClient:   &http.Client{},
+	}, nil
+}
+
+// Name implements Connector.
+func (c *GitHubConnector) Name() string { return "github" }
+
+// LoginURL implements Connector.
+func (c *GitHubConnector) LoginURL(state string) string {
+	q := url.Values{}
+	q.Set("client_id", c.clientID)
+	q.Set("redirect_uri", c.redirectURL)
+	q.Set("scope", "read:user user:email")
+	q.Set("state", state)
+	return githubAuthorizeURL + "?" + q.Encode()
+}
+
+type githubAccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+// HandleCallback implements Connector, exchanging code for an access token
+// and fetching the authenticated user's profile.
+func (c *GitHubConnector) HandleCallback(ctx context.Context, code string, state string) (Identity, error) {
+	form := url.Values{}
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("code", code)
+	form.Set("redirect_uri", c.redirectURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, githubAccessTokenURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	req.URL.RawQuery = form.Encode()
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchanging GitHub OAuth code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp githubAccessTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return Identity{}, fmt.Errorf("decoding GitHub OAuth token response: %w", err)
+	}
+	if tokenResp.Error != "" {
+		return Identity{}, fmt.Errorf("GitHub OAuth error: %s (%s)", tokenResp.Error, tokenResp.ErrorDesc)
+	}
+	if tokenResp.AccessToken == "" {
+		return Identity{}, errors.New("GitHub OAuth response had no access token")
+	}
+
+	userReq, err := http.NewRequestWithContext(ctx, http.MethodGet, githubUserURL, nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	userReq.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
+	userReq.Header.Set("Accept", "application/vnd.github+json")
+
+	userResp, err := c.httpClient.Do(userReq)
+	if err != nil {
+		return Identity{}, fmt.Errorf("fetching GitHub user profile: %w", err)
+	}
+	defer userResp.Body.Close()
+
+	var user githubUser
+	if err := json.NewDecoder(userResp.Body).Decode(&user); err != nil {
+		return Identity{}, fmt.Errorf("decoding GitHub user profile: %w", err)
+	}
+
+	createdAt, _ := time.Parse(time.RFC3339, user.CreatedAt)
+
+	return Identity{
+		Connector:         c.Name(),
+		Subject:           strconv.FormatInt(user.ID, 10),
+		Email:             user.Email,
+		PreferredUsername: user.Login,
+		Name:              user.Name,
+		AccountCreatedAt:  createdAt,
+	}, nil
+}
+
+// Refresh implements Connector. GitHub OAuth Apps don't issue refresh tokens
+// for this flow, so there's nothing to refresh; callers need a new login.
+func (c *GitHubConnector) Refresh(ctx context.Context, refreshToken string) (Identity, error) {
+	return Identity{}, errors.New("github connector does not support refresh tokens")
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// newOIDCTestServer starts an httptest server serving a discovery document,
+// a JWKS for key, and a token endpoint that returns whatever idToken is set
+// to at request time (so callers can point HandleCallback at it). It returns
+// a connector configured against the server.
+func newOIDCTestServer(t *testing.T, key *rsa.PrivateKey, kid string) (connector *OIDCConnector, idToken *string) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	idToken = new(string)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscoveryDocument{
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcJWKS{Keys: []oidcJWK{{
+			Kty: "RSA",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: *idToken, RefreshToken: "refresh-token"})
+	})
+
+	connector = &OIDCConnector{
+		issuer:       server.URL,
+		clientID:     "test-client",
+		clientSecret: "test-secret",
+		redirectURL:  "https://app.example.com/callback",
+		httpClient:   server.Client(),
+	}
+
+	return connector, idToken
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims oidcClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing test id_token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCConnectorValidateIDTokenAcceptsValidToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+	connector, _ := newOIDCTestServer(t, key, "kid-1")
+
+	idToken := signIDToken(t, key, "kid-1", oidcClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    connector.issuer,
+			Audience:  jwt.ClaimStrings{connector.clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email: "user@example.com",
+		Nonce: connector.nonceFor("state-123"),
+	})
+
+	doc, err := connector.discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	claims, err := connector.validateIDToken(context.Background(), doc, idToken)
+	if err != nil {
+		t.Fatalf("validateIDToken: %v", err)
+	}
+	if claims.Email != "user@example.com" {
+		t.Fatalf("unexpected email in validated claims: %q", claims.Email)
+	}
+}
+
+func TestOIDCConnectorValidateIDTokenRejectsWrongIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+	connector, _ := newOIDCTestServer(t, key, "kid-1")
+
+	idToken := signIDToken(t, key, "kid-1", oidcClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://not-the-configured-issuer.example.com",
+			Audience:  jwt.ClaimStrings{connector.clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+
+	doc, err := connector.discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	if _, err := connector.validateIDToken(context.Background(), doc, idToken); err == nil {
+		t.Fatal("expected validateIDToken to reject a token issued by an unexpected issuer")
+	}
+}
+
+func TestOIDCConnectorHandleCallbackRejectsNonceMismatch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+	connector, idToken := newOIDCTestServer(t, key, "kid-1")
+
+	// The ID token is validly signed and otherwise well-formed, but carries a
+	// nonce derived from a different state than the one HandleCallback is
+	// given - simulating an attacker replaying a token issued for a
+	// different login attempt.
+	*idToken = signIDToken(t, key, "kid-1", oidcClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    connector.issuer,
+			Audience:  jwt.ClaimStrings{connector.clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Nonce: connector.nonceFor("state-from-a-different-login"),
+	})
+
+	_, err = connector.HandleCallback(context.Background(), "some-code", "the-login-state")
+	if err == nil {
+		t.Fatal("expected HandleCallback to reject an id_token whose nonce doesn't match the request's state")
+	}
+}
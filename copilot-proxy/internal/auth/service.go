@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"copilot-proxy/internal/log"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateTTL bounds how long a login's state token is accepted for its
+// callback, limiting the window a leaked or guessed state value is useful
+// for.
+const stateTTL = 10 * time.Minute
+
+// pendingState tracks one outstanding login, so ConsumeLoginState can check
+// the state came from the connector it claims and hasn't expired or already
+// been used.
+type pendingState struct {
+	connector string
+	expires   time.Time
+}
+
+// Service owns the set of configured identity connectors and the state
+// tokens their in-flight logins are tracked by. App registers
+// /auth/{connector}/login and /auth/{connector}/callback for every connector
+// Service knows about.
+type Service struct {
+	mu         sync.RWMutex
+	connectors map[string]Connector
+	states     map[string]pendingState
+
+	// TokenMinter mints an LLM access token from a verified Identity. It's a
+	// function field rather than a direct dependency on package llm, which
+	// would otherwise need to import auth for the reverse direction (llm
+	// hands authenticated requests to auth's VerifyAPIKey); main.go wires it
+	// after constructing the llm.Core.
+	TokenMinter func(Identity) (string, error)
+}
+
+// NewService builds a Service from AUTH_CONNECTORS, a comma-separated list
+// of connector names (e.g. "github,oidc,ci"). A connector whose required
+// environment variables aren't set is logged and skipped rather than
+// failing the whole service, so a misconfigured SSO provider doesn't take
+// down CI's static key connector too.
+func NewService() *Service {
+	s := &Service{
+		connectors: make(map[string]Connector),
+		states:     make(map[string]pendingState),
+	}
+
+	raw := os.Getenv("AUTH_CONNECTORS")
+	if raw == "" {
+		return s
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		connector, err := newConnectorFromEnv(name)
+		if err != nil {
+			log.Context().Tag("auth").Err(err).Warn(fmt.Sprintf("skipping auth connector %q", name))
+			continue
+		}
+
+		s.RegisterConnector(connector)
+	}
+
+	return s
+}
+
+// newConnectorFromEnv builds the named connector from its environment
+// variables.
+func newConnectorFromEnv(name string) (Connector, error) {
+	switch name {
+	case "github":
+		return newGitHubConnectorFromEnv()
+	case "oidc":
+		return newOIDCConnectorFromEnv()
+	case "ci":
+		return newStaticAPIKeyConnectorFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown auth connector %q", name)
+	}
+}
+
+// RegisterConnector adds c to the set App routes /auth/{name}/login and
+// /auth/{name}/callback for. Static API key connectors additionally feed
+// their keys into the package-level VerifyAPIKey registry, since they're
+// checked on every request rather than through a login flow.
+func (s *Service) RegisterConnector(c Connector) {
+	s.mu.Lock()
+	s.connectors[c.Name()] = c
+	s.mu.Unlock()
+
+	if staticConnector, ok := c.(*StaticAPIKeyConnector); ok {
+		registerStaticAPIKeys(staticConnector.keys)
+	}
+}
+
+// Connectors returns every registered connector, for App to build routes
+// from.
+func (s *Service) Connectors() []Connector {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	connectors := make([]Connector, 0, len(s.connectors))
+	for _, c := range s.connectors {
+		connectors = append(connectors, c)
+	}
+	return connectors
+}
+
+// Connector looks up a registered connector by name.
+func (s *Service) Connector(name string) (Connector, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.connectors[name]
+	return c, ok
+}
+
+// NewLoginState starts a login for connectorName, returning the state token
+// its callback must be presented with.
+func (s *Service) NewLoginState(connectorName string) (string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.states[state] = pendingState{connector: connectorName, expires: time.Now().Add(stateTTL)}
+	s.mu.Unlock()
+
+	return state, nil
+}
+
+// ConsumeLoginState validates that state was issued for connectorName,
+// hasn't expired, and hasn't already been used, removing it either way so it
+// can't be replayed.
+func (s *Service) ConsumeLoginState(connectorName, state string) error {
+	s.mu.Lock()
+	pending, ok := s.states[state]
+	delete(s.states, state)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("unknown or already-used login state")
+	}
+	if pending.connector != connectorName {
+		return errors.New("login state was issued for a different connector")
+	}
+	if time.Now().After(pending.expires) {
+		return errors.New("login state expired")
+	}
+	return nil
+}
+
+// randomToken returns a 32-character hex-encoded random token, suitable for
+// use as OAuth/OIDC state.
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// GetStatus reports whether any connectors are configured, for the
+// /status endpoint.
+func (s *Service) GetStatus() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.connectors) == 0 {
+		return "no auth connectors configured"
+	}
+	return "ok"
+}
+
+// Authenticate is superseded by the per-connector /auth/{name}/login and
+// /auth/{name}/callback flow; it's kept only so callers that haven't
+// migrated off the old single-endpoint /authenticate don't hard-fail.
+func (s *Service) Authenticate() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.connectors) == 0 {
+		return errors.New("no auth connectors configured")
+	}
+	return nil
+}
+
+// RefreshAny tries refreshToken against every registered connector in turn,
+// returning the first successful Identity. Callers that know which
+// connector issued the token should call its Refresh directly instead.
+func (s *Service) RefreshAny(ctx context.Context, refreshToken string) (Identity, error) {
+	for _, c := range s.Connectors() {
+		identity, err := c.Refresh(ctx, refreshToken)
+		if err == nil {
+			return identity, nil
+		}
+	}
+	return Identity{}, errors.New("no connector accepted this refresh token")
+}
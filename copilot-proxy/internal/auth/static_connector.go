@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// staticAPIKeysMu guards staticAPIKeys, the registry VerifyAPIKey checks.
+// It's package-level rather than a Service field because handleOpenAI
+// checks it outside of any particular Service instance.
+var (
+	staticAPIKeysMu sync.RWMutex
+	staticAPIKeys   = map[string]bool{}
+)
+
+// registerStaticAPIKeys adds keys to the set VerifyAPIKey accepts.
+func registerStaticAPIKeys(keys []string) {
+	staticAPIKeysMu.Lock()
+	defer staticAPIKeysMu.Unlock()
+
+	for _, key := range keys {
+		staticAPIKeys[key] = true
+	}
+}
+
+// VerifyAPIKey reports whether key matches a configured static API key
+// (the "ci" connector). It's independent of any particular Connector
+// instance since it's checked per-request against a package-level registry
+// populated at startup.
+func VerifyAPIKey(key string) bool {
+	staticAPIKeysMu.RLock()
+	defer staticAPIKeysMu.RUnlock()
+
+	return staticAPIKeys[key]
+}
+
+// StaticAPIKeyConnector authenticates CI and other machine clients with a
+// fixed set of pre-shared keys rather than an interactive login flow.
+type StaticAPIKeyConnector struct {
+	keys []string
+}
+
+// newStaticAPIKeyConnectorFromEnv builds a StaticAPIKeyConnector from
+// CI_STATIC_API_KEYS, a comma-separated list of accepted keys.
+func newStaticAPIKeyConnectorFromEnv() (*StaticAPIKeyConnector, error) {
+	raw := os.Getenv("CI_STATIC_API_KEYS")
+	if raw == "" {
+		return nil, errors.New("CI_STATIC_API_KEYS is required")
+	}
+
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("CI_STATIC_API_KEYS had no usable keys")
+	}
+
+	return &StaticAPIKeyConnector{keys: keys}, nil
+}
+
+// Name implements Connector.
+func (c *StaticAPIKeyConnector) Name() string { return "ci" }
+
+// LoginURL implements Connector. There's no interactive login for a static
+// key; this is only present so StaticAPIKeyConnector satisfies Connector.
+func (c *StaticAPIKeyConnector) LoginURL(state string) string { return "" }
+
+// HandleCallback implements Connector. Static keys aren't issued through a
+// callback, so this always fails.
+func (c *StaticAPIKeyConnector) HandleCallback(ctx context.Context, code string, state string) (Identity, error) {
+	return Identity{}, errors.New("ci connector does not support interactive login")
+}
+
+// Refresh implements Connector. Static keys don't expire, so there's
+// nothing to refresh.
+func (c *StaticAPIKeyConnector) Refresh(ctx context.Context, refreshToken string) (Identity, error) {
+	return Identity{}, errors.New("ci connector does not support refresh tokens")
+}
@@ -0,0 +1,240 @@
+// Package entitlements decides, independent of any single HTTP route, which
+// providers, models, and limits a given LLMToken is entitled to use. Core
+// routing code asks a Resolver once per request instead of hard-coding plan
+// logic inline, so adding a new paid feature means adding an entitlement,
+// not touching every handler.
+package entitlements
+
+import (
+	"copilot-proxy/pkg/models"
+	"fmt"
+)
+
+// Plan identifies which tier of entitlements a user falls into before any
+// per-user override is applied.
+type Plan string
+
+const (
+	PlanFree  Plan = "free"
+	PlanPro   Plan = "pro"
+	PlanStaff Plan = "staff"
+)
+
+// Operation identifies what kind of request is being checked, so Check can
+// skip limits that don't apply to it (a monthly token cap means nothing to
+// OpListModels).
+type Operation string
+
+const (
+	OpChatCompletion Operation = "chat_completion"
+	OpEmbeddings     Operation = "embeddings"
+	OpListModels     Operation = "list_models"
+)
+
+// Reason is a structured, machine-readable explanation for a denied Check,
+// meant to be surfaced to clients (e.g. as a response header) so they can
+// react - prompt an upgrade, explain a waitlist - without string-matching
+// an error message.
+type Reason string
+
+const (
+	ReasonRequiresSubscription Reason = "requires_subscription"
+	ReasonClosedBeta           Reason = "closed_beta"
+	ReasonStaffOnly            Reason = "staff_only"
+	ReasonMonthlyCapExceeded   Reason = "monthly_cap_exceeded"
+)
+
+// Entitlements describes what a resolved user may do. Always construct one
+// via Resolver.Resolve rather than by hand - the zero value denies every
+// provider and model.
+type Entitlements struct {
+	AllowedProviders []models.LanguageModelProvider
+	AllowedModels    []string // empty means "any model from AllowedProviders"
+	MaxContextTokens uint32
+	ClosedBetaAccess bool
+	StaffOnlyModels  []string
+	MonthlyTokenCap  uint32 // 0 means unlimited
+}
+
+func (e Entitlements) allowsProvider(provider models.LanguageModelProvider) bool {
+	for _, p := range e.AllowedProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Entitlements) allowsModel(model string) bool {
+	if len(e.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range e.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Entitlements) isStaffOnly(model string) bool {
+	for _, m := range e.StaffOnlyModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanStore resolves which Plan a user is on and any per-user overrides
+// layered on top of it. A real implementation would read this from the
+// billing/subscription database; Resolver works fine with a nil store,
+// treating every token as PlanFree with no overrides.
+type PlanStore interface {
+	PlanFor(token *models.LLMToken) Plan
+	// Overrides returns per-user entitlement overrides, if any have been
+	// granted (e.g. a support rep comping a user into a closed beta).
+	Overrides(userID uint64) (Entitlements, bool)
+}
+
+// freeEntitlements are the defaults available to every token with no plan
+// at all - the baseline this project ships with.
+var freeEntitlements = Entitlements{
+	AllowedProviders: []models.LanguageModelProvider{models.ProviderCopilot},
+}
+
+// planEntitlements are the defaults for each Plan.
+var planEntitlements = map[Plan]Entitlements{
+	PlanFree: freeEntitlements,
+	PlanPro: {
+		AllowedProviders: []models.LanguageModelProvider{
+			models.ProviderCopilot, models.ProviderOpenAI, models.ProviderAnthropic, models.ProviderGoogle,
+		},
+		MaxContextTokens: 128000,
+	},
+	PlanStaff: {
+		AllowedProviders: []models.LanguageModelProvider{
+			models.ProviderCopilot, models.ProviderOpenAI, models.ProviderAnthropic, models.ProviderGoogle,
+		},
+		MaxContextTokens: 128000,
+		ClosedBetaAccess: true,
+	},
+}
+
+// Resolver derives a token's Entitlements by layering base plan defaults and
+// any per-user override from store, in that order, so later layers only
+// need to describe what's different.
+type Resolver struct {
+	store PlanStore
+}
+
+// NewResolver creates a Resolver backed by store. A nil store is valid and
+// resolves every token to its plan's defaults with no per-user overrides.
+func NewResolver(store PlanStore) *Resolver {
+	return &Resolver{store: store}
+}
+
+// Resolve computes a token's Entitlements. IsStaff always resolves to at
+// least PlanStaff's entitlements and unlocks ClosedBetaAccess, regardless of
+// what the PlanStore reports - staff access is meant to be unconditional.
+func (r *Resolver) Resolve(token *models.LLMToken) Entitlements {
+	plan := PlanFree
+	if r.store != nil {
+		plan = r.store.PlanFor(token)
+	}
+	if token.IsStaff {
+		plan = PlanStaff
+	}
+
+	result, ok := planEntitlements[plan]
+	if !ok {
+		result = freeEntitlements
+	}
+
+	if r.store != nil {
+		if override, ok := r.store.Overrides(token.UserID); ok {
+			result = mergeOverride(result, override)
+		}
+	}
+
+	if token.IsStaff {
+		result.ClosedBetaAccess = true
+	}
+
+	return result
+}
+
+// mergeOverride layers a per-user override onto base: any non-zero field on
+// override replaces the corresponding field on base.
+func mergeOverride(base, override Entitlements) Entitlements {
+	if len(override.AllowedProviders) > 0 {
+		base.AllowedProviders = override.AllowedProviders
+	}
+	if len(override.AllowedModels) > 0 {
+		base.AllowedModels = override.AllowedModels
+	}
+	if override.MaxContextTokens > 0 {
+		base.MaxContextTokens = override.MaxContextTokens
+	}
+	if override.ClosedBetaAccess {
+		base.ClosedBetaAccess = true
+	}
+	if len(override.StaffOnlyModels) > 0 {
+		base.StaffOnlyModels = override.StaffOnlyModels
+	}
+	if override.MonthlyTokenCap > 0 {
+		base.MonthlyTokenCap = override.MonthlyTokenCap
+	}
+	return base
+}
+
+// DeniedError is returned by Check when a request isn't entitled, carrying a
+// structured Reason callers can translate into an HTTP response without
+// string-matching the error message.
+type DeniedError struct {
+	Reason  Reason
+	Message string
+}
+
+func (e *DeniedError) Error() string {
+	return e.Message
+}
+
+// CheckParams carries the request-specific details Check needs beyond the
+// token itself.
+type CheckParams struct {
+	Provider models.LanguageModelProvider
+	Model    string
+	Op       Operation
+	// IsClosedBetaModel should be true when Model is this deployment's
+	// Config.ClosedBetaModelName; entitlements doesn't know about Config.
+	IsClosedBetaModel bool
+	// MonthlyTokensUsed is how many tokens the user has already spent this
+	// calendar month, for comparison against MonthlyTokenCap.
+	MonthlyTokensUsed uint32
+}
+
+// Check resolves token's entitlements and reports whether it may perform
+// params.Op against params.Provider/params.Model, returning a *DeniedError
+// with a structured Reason when it may not.
+func (r *Resolver) Check(token *models.LLMToken, params CheckParams) error {
+	ent := r.Resolve(token)
+
+	if params.IsClosedBetaModel && !ent.ClosedBetaAccess {
+		return &DeniedError{Reason: ReasonClosedBeta, Message: "this model is in closed beta"}
+	}
+
+	if ent.isStaffOnly(params.Model) && !token.IsStaff {
+		return &DeniedError{Reason: ReasonStaffOnly, Message: "this model is staff-only"}
+	}
+
+	if !ent.allowsProvider(params.Provider) || !ent.allowsModel(params.Model) {
+		return &DeniedError{Reason: ReasonRequiresSubscription, Message: fmt.Sprintf("your plan doesn't include %s", params.Model)}
+	}
+
+	if params.Op != OpListModels && ent.MonthlyTokenCap > 0 && params.MonthlyTokensUsed >= ent.MonthlyTokenCap {
+		return &DeniedError{Reason: ReasonMonthlyCapExceeded, Message: "monthly token cap exceeded"}
+	}
+
+	return nil
+}
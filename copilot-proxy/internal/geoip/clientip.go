@@ -0,0 +1,44 @@
+package geoip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the real client IP for r: the right-most
+// X-Forwarded-For entry that isn't inside trustedProxies (proxies prepend
+// their own address as they forward a request, so the real client is
+// found by walking from the right until an untrusted hop appears),
+// falling back to r.RemoteAddr if the header is absent or every entry is
+// trusted. trustedProxies should list the CIDR ranges of your own load
+// balancers and reverse proxies - an untrusted X-Forwarded-For header is
+// trivial for a client to forge.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) net.IP {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		parts := strings.Split(xff, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(parts[i]))
+			if err != nil || isTrusted(addr, trustedProxies) {
+				continue
+			}
+			return net.IP(addr.AsSlice())
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
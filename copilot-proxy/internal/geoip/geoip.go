@@ -0,0 +1,78 @@
+// Package geoip resolves a client IP to an ISO country code via a MaxMind
+// GeoLite2 database, flags IPs known to be Tor exit nodes, and extracts the
+// real client IP from a request behind a trusted reverse proxy.
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Resolver maps an IP address to the ISO country code a GeoIP database has
+// for it.
+type Resolver interface {
+	Country(ip net.IP) (string, bool)
+}
+
+// MaxMindResolver resolves countries from a GeoLite2-Country mmdb file,
+// opened once at startup and swappable in place via Reload, so a stale
+// database can be replaced (e.g. after MaxMind ships a new release) without
+// restarting the process.
+type MaxMindResolver struct {
+	path   string
+	reader atomic.Pointer[geoip2.Reader]
+}
+
+// NewMaxMindResolver opens the mmdb file at path and returns a Resolver
+// backed by it.
+func NewMaxMindResolver(path string) (*MaxMindResolver, error) {
+	r := &MaxMindResolver{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reopens the mmdb file at r.path and atomically swaps it in,
+// closing the previous reader once nothing can still be using it. Safe to
+// call concurrently with Country.
+func (r *MaxMindResolver) Reload() error {
+	reader, err := geoip2.Open(r.path)
+	if err != nil {
+		return err
+	}
+
+	if old := r.reader.Swap(reader); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// WatchReload spawns a goroutine that calls Reload every time sig receives a
+// value. Wire this to a channel registered with signal.Notify(sig,
+// syscall.SIGHUP) so an operator can roll out a refreshed GeoLite2 database
+// with `kill -HUP` instead of a restart.
+func (r *MaxMindResolver) WatchReload(sig <-chan os.Signal) {
+	go func() {
+		for range sig {
+			r.Reload()
+		}
+	}()
+}
+
+// Country returns ip's ISO country code, if the database has one.
+func (r *MaxMindResolver) Country(ip net.IP) (string, bool) {
+	reader := r.reader.Load()
+	if reader == nil {
+		return "", false
+	}
+
+	record, err := reader.Country(ip)
+	if err != nil || record.Country.IsoCode == "" {
+		return "", false
+	}
+	return record.Country.IsoCode, true
+}
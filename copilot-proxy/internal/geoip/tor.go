@@ -0,0 +1,112 @@
+package geoip
+
+import (
+	"bufio"
+	"context"
+	"copilot-proxy/internal/log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go4.org/netipx"
+)
+
+// torExitListURL is the Tor Project's official, periodically-updated list
+// of current exit node IPs.
+const torExitListURL = "https://check.torproject.org/exit-addresses"
+
+// TorDetector reports whether an IP is a known Tor exit node.
+type TorDetector interface {
+	Contains(ip net.IP) bool
+}
+
+// TorExitNodes is a TorDetector backed by torExitListURL, refreshed
+// periodically into a netipx.IPSet that's swapped in atomically so Contains
+// never blocks on an in-flight fetch.
+type TorExitNodes struct {
+	httpClient *http.Client
+	set        atomic.Pointer[netipx.IPSet]
+}
+
+// NewTorExitNodes creates a detector with an empty set. Call Refresh once
+// before serving traffic, and Start to keep the set current afterward.
+func NewTorExitNodes() *TorExitNodes {
+	return &TorExitNodes{httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Contains reports whether ip was in the most recently fetched exit-node
+// set. An empty or not-yet-fetched set never matches.
+func (t *TorExitNodes) Contains(ip net.IP) bool {
+	set := t.set.Load()
+	if set == nil {
+		return false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip.To16())
+	if !ok {
+		return false
+	}
+	// AddrFromSlice(ip.To16()) always produces a 4-in-6-mapped address, but
+	// Refresh builds the set from netip.ParseAddr on dotted-decimal strings,
+	// which produces native IPv4 addresses. The two forms don't compare
+	// equal, so an un-mapped lookup would silently miss every IPv4 entry.
+	return set.Contains(addr.Unmap())
+}
+
+// Refresh fetches torExitListURL and replaces the current exit-node set with
+// the IPs it lists, each on an "ExitAddress <ip> <date>" line.
+func (t *TorExitNodes) Refresh() error {
+	resp, err := t.httpClient.Get(torExitListURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var b netipx.IPSetBuilder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "ExitAddress" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(fields[1]); err == nil {
+			b.Add(addr)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	set, err := b.IPSet()
+	if err != nil {
+		return err
+	}
+
+	t.set.Store(set)
+	return nil
+}
+
+// Start refreshes the exit-node set every interval until ctx is canceled.
+// A failed Refresh is logged and otherwise ignored; the previous set stays
+// in effect until the next successful fetch.
+func (t *TorExitNodes) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := t.Refresh(); err != nil {
+				log.Context().Tag("geoip").Err(err).Warn("failed to refresh Tor exit node list")
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package geoip
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"go4.org/netipx"
+)
+
+func TestTorExitNodesContainsMatchesIPv4String(t *testing.T) {
+	var b netipx.IPSetBuilder
+	b.Add(netip.MustParseAddr("198.51.100.7"))
+	set, err := b.IPSet()
+	if err != nil {
+		t.Fatalf("building IPSet: %v", err)
+	}
+
+	detector := NewTorExitNodes()
+	detector.set.Store(set)
+
+	if !detector.Contains(net.ParseIP("198.51.100.7")) {
+		t.Fatal("expected a plain IPv4 string to round-trip through Contains and match the exit-node set")
+	}
+	if detector.Contains(net.ParseIP("198.51.100.8")) {
+		t.Fatal("expected an IP not in the exit-node set to not match")
+	}
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler exposes operator-only endpoints for inspecting and managing
+// the LLM service: enabled models, a user's usage, rate limit status, and
+// per-provider health. It's gated by a separate admin API key rather than
+// end-user tokens.
+type AdminHandler struct {
+	core     *Core
+	adminKey string
+}
+
+// NewAdminHandler wraps core with the /admin/* endpoints, authenticated
+// against adminKey.
+func NewAdminHandler(core *Core, adminKey string) *AdminHandler {
+	return &AdminHandler{core: core, adminKey: adminKey}
+}
+
+// authenticate checks the X-Admin-Key header against the configured admin key.
+func (h *AdminHandler) authenticate(r *http.Request) bool {
+	return h.adminKey != "" && r.Header.Get("X-Admin-Key") == h.adminKey
+}
+
+// HandleListModels returns every configured model, regardless of a user's
+// plan or country.
+func (h *AdminHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticate(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ListModelsResponse{Models: DefaultModels()})
+}
+
+// HandleUserUsage returns the current usage counters for a given user across
+// the requested provider and model.
+func (h *AdminHandler) HandleUserUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticate(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, ok := parseUserIDPath(r.URL.Path, "/admin/users/", "/usage")
+	if !ok {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	provider := models.LanguageModelProvider(r.URL.Query().Get("provider"))
+	model := r.URL.Query().Get("model")
+
+	usage := h.core.Service.GetModelUsage(userID, provider, model)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// HandleRateLimits reports whether the Core has a rate limiter configured.
+// A full rate-limit inspection endpoint would query the limiter's store
+// directly; this is a lightweight health signal for operators.
+func (h *AdminHandler) HandleRateLimits(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticate(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{
+		"rate_limiting_enabled": h.core.RateLimiter != nil,
+	})
+}
+
+// HandleProviderHealth reports whether the named provider is currently enabled.
+func (h *AdminHandler) HandleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticate(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/admin/providers/")
+	name = strings.TrimSuffix(name, "/health")
+
+	healthy := false
+	for _, provider := range h.core.Providers.Enabled() {
+		if string(provider) == name {
+			healthy = true
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"healthy": healthy})
+}
+
+// RegisterHandlers registers the admin LLM handlers with a router
+func (h *AdminHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/models", h.HandleListModels)
+	mux.HandleFunc("/admin/users/", h.HandleUserUsage)
+	mux.HandleFunc("/admin/rate-limits", h.HandleRateLimits)
+	mux.HandleFunc("/admin/providers/", h.HandleProviderHealth)
+}
+
+// parseUserIDPath extracts the numeric user ID from a path of the shape
+// prefix+"{id}"+suffix, e.g. "/admin/users/42/usage".
+func parseUserIDPath(path, prefix, suffix string) (uint64, bool) {
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix)
+	userID, err := strconv.ParseUint(trimmed, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
+}
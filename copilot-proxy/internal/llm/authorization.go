@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // Restricted countries based on export regulations
@@ -30,9 +32,6 @@ var (
 		"VE": true, // Venezuela
 		"YE": true, // Yemen
 	}
-
-	// TOR network identifier
-	torNetwork = "T1"
 )
 
 // Authorization errors
@@ -45,22 +44,21 @@ var (
 	ErrSpendingLimitReached = errors.New("monthly spending limit reached")
 )
 
-// AuthorizeAccessToModel checks if a user can access a specific model
-func AuthorizeAccessToModel(token *models.LLMToken, provider models.LanguageModelProvider, modelName string) error {
+// AuthorizeAccessToModel checks if a user can access a specific model.
+// registry resolves whether modelName is free to every plan via the
+// matching Provider's AvailableToAllPlans, replacing what used to be
+// hardcoded per-provider/per-model branches here; registry may be nil, in
+// which case every non-staff, non-beta model is denied.
+func AuthorizeAccessToModel(registry *Registry, token *models.LLMToken, provider models.LanguageModelProvider, modelName string) error {
 	// Staff can access all models
 	if token.IsStaff {
 		return nil
 	}
 
-	// Copilot models are available to all users with valid tokens
-	if provider == models.ProviderCopilot {
-		return nil
-	}
-
-	// Claude 3.5 sonnet is available to all plans
-	if provider == models.ProviderAnthropic &&
-		(modelName == "claude-3-5-sonnet" || modelName == "claude-3-7-sonnet") {
-		return nil
+	if registry != nil {
+		if p, ok := registry.Get(provider); ok && p.AvailableToAllPlans(modelName) {
+			return nil
+		}
 	}
 
 	// Other models require specific access
@@ -73,19 +71,24 @@ func AuthorizeAccessToModel(token *models.LLMToken, provider models.LanguageMode
 	return ErrModelNotAvailable
 }
 
-// AuthorizeAccessForCountry checks if a model can be accessed from the user's country
-func AuthorizeAccessForCountry(countryCode *string, provider models.LanguageModelProvider) error {
-	// In development, we may not have country codes
-	if countryCode == nil || *countryCode == "XX" {
-		return ErrNoCountryCode
-	}
-
-	// Block TOR network
-	if *countryCode == torNetwork {
+// AuthorizeAccessForCountry checks if a model can be accessed given the
+// caller's resolved country and whether its connection is coming from a
+// known Tor exit node, as resolved by Core.resolveCountry. isTorExit
+// replaces the former magic "T1" country-code sentinel, now that Tor status
+// is determined from the connecting IP via geoip.TorDetector rather than
+// self-reported by the client.
+func AuthorizeAccessForCountry(countryCode *string, isTorExit bool, provider models.LanguageModelProvider) error {
+	if isTorExit {
 		return fmt.Errorf("%w: access to %s models is not available over TOR",
 			ErrTorNetwork, provider)
 	}
 
+	// In development, or without a GeoIP resolver configured, we may not
+	// have a country code
+	if countryCode == nil || *countryCode == "XX" {
+		return ErrNoCountryCode
+	}
+
 	// Check country restrictions
 	if restrictedCountries[*countryCode] {
 		return fmt.Errorf("%w: access to %s models is not available in your region (%s)",
@@ -95,8 +98,33 @@ func AuthorizeAccessForCountry(countryCode *string, provider models.LanguageMode
 	return nil
 }
 
-// CheckRateLimit verifies the user hasn't exceeded their rate limits
-func CheckRateLimit(userID uint64, provider models.LanguageModelProvider, modelName string,
+// RateLimitError is returned by CheckRateLimit when a request is rejected,
+// carrying the window that was exhausted and how long the caller should
+// wait before retrying so SetErrorResponseHeaders can surface a real
+// Retry-After instead of a guess.
+type RateLimitError struct {
+	Window     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: maximum %s reached", ErrRateLimitExceeded, e.Window)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimitExceeded
+}
+
+// CheckRateLimit verifies the user hasn't exceeded their rate limits.
+//
+// The requests-per-minute window is enforced by atomically consuming from
+// limiter rather than by comparing a snapshot: two concurrent requests can't
+// both read "one request left" and both proceed. limiter may be nil, in
+// which case this window falls back to the same snapshot comparison as the
+// others. The remaining windows are token budgets whose cost isn't known
+// until the completion finishes, so they stay snapshot comparisons against
+// whatever usage the caller's UsageStore already tracked.
+func CheckRateLimit(limiter RateLimiter, userID uint64, provider models.LanguageModelProvider, modelName string,
 	usage models.ModelUsage, activeUsers models.ActiveUserCount) error {
 
 	availableModels := DefaultModels()
@@ -133,7 +161,16 @@ func CheckRateLimit(userID uint64, provider models.LanguageModelProvider, modelN
 	perUserMaxTokensPerDay := model.MaxTokensPerDay / usersInRecentDays
 
 	// Check if any limits are exceeded
-	if usage.RequestsThisMinute > perUserMaxRequestsPerMinute {
+	if limiter != nil {
+		key := fmt.Sprintf("%s:%s:requests_per_minute", provider, modelName)
+		allowed, retryAfter, err := limiter.Allow(userID, key, 1)
+		if err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+		if !allowed {
+			return &RateLimitError{Window: "requests_per_minute", RetryAfter: retryAfter}
+		}
+	} else if usage.RequestsThisMinute > perUserMaxRequestsPerMinute {
 		return fmt.Errorf("%w: maximum requests_per_minute reached", ErrRateLimitExceeded)
 	}
 
@@ -185,40 +222,67 @@ func CheckSpendingLimit(token *models.LLMToken, currentSpending uint32) error {
 	return nil
 }
 
-// SetErrorResponseHeaders sets the appropriate headers for error responses
+// SetErrorResponseHeaders sets the appropriate headers for error responses.
+// Retry-After reflects whatever window CheckRateLimit actually exhausted
+// when err is a *RateLimitError, falling back to a flat 60 seconds for
+// callers that only have a bare ErrRateLimitExceeded to report.
 func SetErrorResponseHeaders(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, ErrSpendingLimitReached):
 		w.Header().Set("X-LLM-Monthly-Spend-Reached", "true")
 	case errors.Is(err, ErrRateLimitExceeded):
-		w.Header().Set("Retry-After", "60")
+		retryAfter := 60 * time.Second
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > 0 {
+			retryAfter = rateLimitErr.RetryAfter
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
 	}
 }
 
-// ValidateAccess performs all authorization checks for an LLM request
-func ValidateAccess(token *models.LLMToken, countryCode *string, provider models.LanguageModelProvider,
+// ValidateAccess performs all authorization checks for an LLM request.
+// limiter is passed through to CheckRateLimit and registry to
+// AuthorizeAccessToModel; both may be nil. Every denial increments
+// authDeniedTotal and writes an audit event via recordDenial; a successful
+// call increments requestsTotal and records currentSpending against
+// spendCentsTotal. The whole call is timed into requestLatency.
+func ValidateAccess(limiter RateLimiter, registry *Registry, token *models.LLMToken, countryCode *string, isTorExit bool, provider models.LanguageModelProvider,
 	modelName string, usage models.ModelUsage, activeUsers models.ActiveUserCount,
 	currentSpending uint32) error {
 
+	defer observeAccessLatency(provider, modelName)()
+
+	country := "unknown"
+	if countryCode != nil {
+		country = *countryCode
+	}
+
 	// Check country restrictions
-	if err := AuthorizeAccessForCountry(countryCode, provider); err != nil {
+	if err := AuthorizeAccessForCountry(countryCode, isTorExit, provider); err != nil {
+		recordDenial(err, token, provider, modelName, country)
 		return err
 	}
 
 	// Check if model is available to user's plan
-	if err := AuthorizeAccessToModel(token, provider, modelName); err != nil {
+	if err := AuthorizeAccessToModel(registry, token, provider, modelName); err != nil {
+		recordDenial(err, token, provider, modelName, country)
 		return err
 	}
 
 	// Check spending limits
 	if err := CheckSpendingLimit(token, currentSpending); err != nil {
+		recordDenial(err, token, provider, modelName, country)
 		return err
 	}
 
 	// Check rate limits
-	if err := CheckRateLimit(token.UserID, provider, modelName, usage, activeUsers); err != nil {
+	if err := CheckRateLimit(limiter, token.UserID, provider, modelName, usage, activeUsers); err != nil {
+		recordDenial(err, token, provider, modelName, country)
 		return err
 	}
 
+	requestsTotal.WithLabelValues(string(provider), modelName).Inc()
+	spendCentsTotal.WithLabelValues(truncatedUserID(token.UserID)).Set(float64(currentSpending))
+
 	return nil
 }
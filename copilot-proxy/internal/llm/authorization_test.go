@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"copilot-proxy/pkg/models"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestValidateAccessDeniesTorAndRecordsAuditMetrics(t *testing.T) {
+	token := &models.LLMToken{UserID: 1}
+	country := "US"
+
+	before := testutil.ToFloat64(authDeniedTotal.WithLabelValues("tor_network", string(models.ProviderOpenAI), "gpt-4", country))
+
+	err := ValidateAccess(nil, nil, token, &country, true /* isTorExit */, models.ProviderOpenAI, "gpt-4",
+		models.ModelUsage{}, models.ActiveUserCount{}, 0)
+
+	if !errors.Is(err, ErrTorNetwork) {
+		t.Fatalf("expected ErrTorNetwork, got %v", err)
+	}
+
+	after := testutil.ToFloat64(authDeniedTotal.WithLabelValues("tor_network", string(models.ProviderOpenAI), "gpt-4", country))
+	if after != before+1 {
+		t.Fatalf("expected authDeniedTotal{tor_network} to increment by 1, went from %v to %v", before, after)
+	}
+}
+
+func TestValidateAccessDeniesRestrictedCountryAndRecordsAuditMetrics(t *testing.T) {
+	token := &models.LLMToken{UserID: 1}
+	country := "RU"
+
+	before := testutil.ToFloat64(authDeniedTotal.WithLabelValues("restricted_region", string(models.ProviderOpenAI), "gpt-4", country))
+
+	err := ValidateAccess(nil, nil, token, &country, false, models.ProviderOpenAI, "gpt-4",
+		models.ModelUsage{}, models.ActiveUserCount{}, 0)
+
+	if !errors.Is(err, ErrRestrictedRegion) {
+		t.Fatalf("expected ErrRestrictedRegion, got %v", err)
+	}
+
+	after := testutil.ToFloat64(authDeniedTotal.WithLabelValues("restricted_region", string(models.ProviderOpenAI), "gpt-4", country))
+	if after != before+1 {
+		t.Fatalf("expected authDeniedTotal{restricted_region} to increment by 1, went from %v to %v", before, after)
+	}
+}
+
+func TestValidateAccessAllowsAndRecordsRequestMetrics(t *testing.T) {
+	token := &models.LLMToken{UserID: 1, IsStaff: true}
+	country := "US"
+
+	beforeRequests := testutil.ToFloat64(requestsTotal.WithLabelValues(string(models.ProviderOpenAI), "gpt-4"))
+
+	err := ValidateAccess(nil, nil, token, &country, false, models.ProviderOpenAI, "gpt-4",
+		models.ModelUsage{}, models.ActiveUserCount{}, 0)
+
+	if err != nil {
+		t.Fatalf("expected a staff token in an unrestricted country to be allowed, got %v", err)
+	}
+
+	afterRequests := testutil.ToFloat64(requestsTotal.WithLabelValues(string(models.ProviderOpenAI), "gpt-4"))
+	if afterRequests != beforeRequests+1 {
+		t.Fatalf("expected requestsTotal to increment by 1 on a successful ValidateAccess, went from %v to %v", beforeRequests, afterRequests)
+	}
+
+	spend := testutil.ToFloat64(spendCentsTotal.WithLabelValues(truncatedUserID(token.UserID)))
+	if spend != 0 {
+		t.Fatalf("expected spendCentsTotal to reflect currentSpending (0), got %v", spend)
+	}
+}
+
+func TestErrorClassMapsEveryValidateAccessError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrNoCountryCode, "no_country_code"},
+		{ErrTorNetwork, "tor_network"},
+		{ErrRestrictedRegion, "restricted_region"},
+		{ErrModelNotAvailable, "model_not_available"},
+		{ErrRateLimitExceeded, "rate_limit_exceeded"},
+		{ErrSpendingLimitReached, "spending_limit_reached"},
+		{errors.New("some other error"), "unknown"},
+	}
+
+	for _, c := range cases {
+		if got := errorClass(c.err); got != c.want {
+			t.Errorf("errorClass(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
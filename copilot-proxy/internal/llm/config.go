@@ -14,14 +14,18 @@ import (
 type Config struct {
 	// OpenAIAPIKey is the API key for accessing OpenAI services
 	OpenAIAPIKey string
-	// CopilotAPIKey is the API key for accessing GitHub Copilot Chat
-	CopilotAPIKey string
+	// copilotAPIKey is the static fallback API key for accessing GitHub
+	// Copilot Chat, read once at startup. Prefer calling CopilotAPIKey(),
+	// which also consults a registered copilotTokenSource.
+	copilotAPIKey string
 	// AnthropicAPIKey is the API key for accessing Anthropic models
 	AnthropicAPIKey string
 	// AnthropicStaffAPIKey is a special API key for staff access to Anthropic models
 	AnthropicStaffAPIKey string
 	// GoogleAIAPIKey is the API key for accessing Google AI models
 	GoogleAIAPIKey string
+	// CohereAPIKey is the API key for accessing Cohere models
+	CohereAPIKey string
 	// EnabledProviders is the list of currently enabled LLM providers
 	EnabledProviders []models.LanguageModelProvider
 	// ClosedBetaModelName is the name of a model that's in closed beta (if any)
@@ -60,10 +64,11 @@ func GetConfig() *Config {
 
 		config = &Config{
 			OpenAIAPIKey:             os.Getenv("OPENAI_API_KEY"),
-			CopilotAPIKey:            copilotAPIKey,
+			copilotAPIKey:            copilotAPIKey,
 			AnthropicAPIKey:          os.Getenv("ANTHROPIC_API_KEY"),
 			AnthropicStaffAPIKey:     os.Getenv("ANTHROPIC_STAFF_API_KEY"),
 			GoogleAIAPIKey:           os.Getenv("GOOGLE_AI_API_KEY"),
+			CohereAPIKey:             os.Getenv("COHERE_API_KEY"),
 			EnabledProviders:         defaultEnabledProviders(copilotAPIKey),
 			DefaultMaxMonthlySpend:   1000, // $10.00 in cents
 			FreeTierMonthlyAllowance: 1000, // $10.00 in cents
@@ -72,6 +77,33 @@ func GetConfig() *Config {
 	return config
 }
 
+// copilotTokenSource, when set, supplies a live GitHub Copilot API key that
+// takes priority over the static value captured in Config at startup. It's
+// registered by SetCopilotTokenSource, typically backed by the refreshing
+// cache from the Copilot OAuth device code flow (see internal/auth/copilot),
+// so long-running processes keep working as that cache rotates the key.
+var copilotTokenSource func() (string, bool)
+
+// SetCopilotTokenSource registers src as the live source of the GitHub
+// Copilot API key. Call this once at startup, before serving traffic, after
+// constructing whatever keeps the key fresh. Passing nil reverts to the
+// static value loaded by GetConfig.
+func SetCopilotTokenSource(src func() (string, bool)) {
+	copilotTokenSource = src
+}
+
+// CopilotAPIKey returns the current GitHub Copilot API key: the live value
+// from a registered copilotTokenSource if one is set and has a key, otherwise
+// the static value GetConfig loaded at startup.
+func (c *Config) CopilotAPIKey() string {
+	if copilotTokenSource != nil {
+		if token, ok := copilotTokenSource(); ok {
+			return token
+		}
+	}
+	return c.copilotAPIKey
+}
+
 // defaultEnabledProviders determines which LLM providers should be enabled
 // based on available API keys. A provider is only enabled if its API key is available.
 //
@@ -98,6 +130,9 @@ func defaultEnabledProviders(copilotAPIKey string) []models.LanguageModelProvide
 	if os.Getenv("GOOGLE_AI_API_KEY") != "" {
 		providers = append(providers, models.ProviderGoogle)
 	}
+	if os.Getenv("COHERE_API_KEY") != "" {
+		providers = append(providers, models.ProviderCohere)
+	}
 
 	return providers
 }
@@ -142,5 +177,16 @@ func DefaultModels() []models.LanguageModel {
 			MaxTokensPerDay:          60000,
 			Enabled:                  true,
 		},
+		{
+			ID:                       "command-r-plus",
+			Name:                     "command-r-plus",
+			Provider:                 models.ProviderCohere,
+			MaxRequestsPerMinute:     15,
+			MaxTokensPerMinute:       3000,
+			MaxInputTokensPerMinute:  1500,
+			MaxOutputTokensPerMinute: 1500,
+			MaxTokensPerDay:          60000,
+			Enabled:                  true,
+		},
 	}
 }
@@ -0,0 +1,180 @@
+package llm
+
+import (
+	"copilot-proxy/internal/entitlements"
+	"copilot-proxy/internal/geoip"
+	"copilot-proxy/pkg/models"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// RateLimiter decides whether a user may consume cost units from a named
+// budget (e.g. "completion", or a model-scoped window such as
+// "openai:gpt-4:tokens_per_minute"), atomically checking and deducting from
+// whatever state the implementation tracks for that key. It's defined
+// locally so Core doesn't need to depend on any particular rate limiter
+// implementation. retryAfter is only meaningful when allowed is false.
+type RateLimiter interface {
+	Allow(userID uint64, key string, cost int) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// ProviderRegistry reports which providers are currently enabled, decoupling
+// Core from any single provider's configuration source.
+type ProviderRegistry interface {
+	Enabled() []models.LanguageModelProvider
+}
+
+// staticProviderRegistry is the default ProviderRegistry, backed by the
+// package-level Config.
+type staticProviderRegistry struct{}
+
+func (staticProviderRegistry) Enabled() []models.LanguageModelProvider {
+	return GetConfig().EnabledProviders
+}
+
+// Core holds everything the public and admin handlers both need: the LLM
+// service, the token verification keys, the rate limiter, and the provider
+// registry. Splitting it out lets the same process serve public and admin
+// traffic, or lets operators run admin-only or public-only binaries that
+// share a Core.
+type Core struct {
+	Service      *Service
+	Keys         *KeyManager // RS256 signing/verification keys; preferred
+	Secret       string      // legacy HS256 secret, used only if Keys is nil
+	RateLimiter  RateLimiter
+	Providers    ProviderRegistry
+	Entitlements *entitlements.Resolver // nil skips entitlement checks entirely
+
+	// GeoIP resolves a client IP to its country. Nil falls back to the
+	// CF-IPCountry header, for deployments (or local dev) without a
+	// GeoLite2 database configured.
+	GeoIP geoip.Resolver
+
+	// TorDetector flags client IPs that are known Tor exit nodes. Nil
+	// disables Tor detection, so the connection is authorized (or not)
+	// purely on its resolved country.
+	TorDetector geoip.TorDetector
+
+	// TrustedProxies lists the CIDR ranges of reverse proxies allowed to
+	// set X-Forwarded-For; anything else claiming to be the client IP
+	// through that header is ignored. Empty means no proxy is trusted, so
+	// resolveClientIP always falls back to RemoteAddr.
+	TrustedProxies []netip.Prefix
+}
+
+// NewCore creates a Core that verifies tokens with a legacy HS256 secret.
+// Kept for migration; prefer NewCoreWithKeys. If rateLimiter is nil, rate
+// limiting is skipped. If providers is nil, the package-level Config's
+// enabled providers are used.
+func NewCore(secret string, rateLimiter RateLimiter, providers ProviderRegistry) *Core {
+	core := newCore(rateLimiter, providers)
+	core.Secret = secret
+	return core
+}
+
+// NewCoreWithKeys creates a Core that verifies RS256 tokens using keys. This
+// is the preferred constructor; NewCore remains for HS256 migration.
+func NewCoreWithKeys(keys *KeyManager, rateLimiter RateLimiter, providers ProviderRegistry) *Core {
+	core := newCore(rateLimiter, providers)
+	core.Keys = keys
+	return core
+}
+
+func newCore(rateLimiter RateLimiter, providers ProviderRegistry) *Core {
+	if providers == nil {
+		providers = staticProviderRegistry{}
+	}
+
+	return &Core{
+		Service:     NewService(),
+		RateLimiter: rateLimiter,
+		Providers:   providers,
+	}
+}
+
+// validateToken extracts and validates the LLM token from a request
+func (c *Core) validateToken(r *http.Request) (*models.LLMToken, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" || len(auth) < 7 || auth[:7] != "Bearer " {
+		return nil, errors.New("invalid or missing authorization header")
+	}
+
+	if c.Keys != nil {
+		return ValidateLLMToken(auth[7:], c.Keys)
+	}
+
+	return ValidateLLMTokenLegacy(auth[7:], c.Secret)
+}
+
+// resolveCountry returns the request's country code and whether it's coming
+// from a known Tor exit node. When c.GeoIP is configured, both are derived
+// from the client IP (via geoip.ClientIP, honoring c.TrustedProxies and
+// c.TorDetector); otherwise it falls back to the CF-IPCountry header with
+// Tor detection disabled, for deployments without a GeoLite2 database wired
+// up yet.
+func (c *Core) resolveCountry(r *http.Request) (countryCode *string, isTorExit bool) {
+	if c.GeoIP == nil {
+		country := r.Header.Get("CF-IPCountry")
+		if country == "" || country == "XX" {
+			return nil, false
+		}
+		return &country, false
+	}
+
+	ip := geoip.ClientIP(r, c.TrustedProxies)
+
+	if c.TorDetector != nil && c.TorDetector.Contains(ip) {
+		isTorExit = true
+	}
+
+	if country, ok := c.GeoIP.Country(ip); ok {
+		countryCode = &country
+	}
+
+	return countryCode, isTorExit
+}
+
+// checkEntitlements runs an entitlements.Check for provider/model against
+// token, if c.Entitlements is configured. A nil Entitlements resolver always
+// allows, preserving existing behavior for deployments that haven't wired
+// one up yet.
+func (c *Core) checkEntitlements(token *models.LLMToken, provider models.LanguageModelProvider, model string, op entitlements.Operation) error {
+	if c.Entitlements == nil {
+		return nil
+	}
+
+	return c.Entitlements.Check(token, entitlements.CheckParams{
+		Provider:          provider,
+		Model:             model,
+		Op:                op,
+		IsClosedBetaModel: model != "" && model == GetConfig().ClosedBetaModelName,
+	})
+}
+
+// writeEntitlementError writes a 403 response for a denied entitlements
+// check, surfacing the structured reason code as X-LLM-Denied-Reason so
+// clients can react programmatically instead of string-matching the body.
+func writeEntitlementError(w http.ResponseWriter, err error) {
+	var denied *entitlements.DeniedError
+	if !errors.As(err, &denied) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("X-LLM-Denied-Reason", string(denied.Reason))
+	http.Error(w, denied.Message, http.StatusForbidden)
+}
+
+// writeTokenError writes the appropriate HTTP error for a failed token
+// validation, flagging expiry with X-LLM-Token-Expired so clients know to
+// refresh rather than re-authenticate from scratch.
+func writeTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrTokenExpired) {
+		w.Header().Set("X-LLM-Token-Expired", "true")
+		http.Error(w, "token expired", http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
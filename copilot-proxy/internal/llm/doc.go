@@ -5,29 +5,50 @@ Package llm implements language model integration for various AI providers.
 
 The LLM package follows a layered architecture pattern:
 
-1. HTTP Handlers (handlers.go)
-  - Provide HTTP API endpoints for model listing and completion requests
-  - Handle authentication, validation, and request routing
+1. HTTP Handlers (core.go, public_handler.go, admin_handler.go, openai_handler.go)
+  - Core holds the shared Service, secret, rate limiter, and provider registry
+  - PublicHandler exposes /models and /completion to end users
+  - OpenAIHandler exposes an OpenAI-compatible /v1/chat/completions,
+    /v1/models, and /v1/embeddings surface, always backed by Copilot Chat,
+    so OpenAI SDK clients can point at this proxy without changes
+  - AdminHandler exposes /admin/* endpoints behind a separate admin API key
   - Convert between HTTP and internal data formats
 
-2. Service Layer (service.go)
+2. Service Layer (service.go, streaming_usage.go)
   - Contains business logic for working with language models
   - Manages rate limiting, provider selection, and token counting
   - Routes requests to appropriate provider APIs
-
-3. Authorization (authorization.go)
+  - ProcessStreamingResponse wraps a streaming response in a
+    streamUsageReader, which forwards bytes to the client unchanged while a
+    per-provider sseUsageParser (OpenAI/Copilot, Anthropic, Google) decodes
+    usage from the SSE frames passing through; providers that don't report
+    usage in-stream fall back to a BPE-ish token estimate over the
+    assistant's delta text
+
+3. Authorization (authorization.go) and entitlements (internal/entitlements)
   - Enforces access control based on user permissions
   - Handles geographical restrictions and rate limits
   - Manages subscription-based access to models
+  - Core.Entitlements, when set, resolves a token's plan-derived
+    Entitlements and is checked before every provider call; denials carry a
+    structured reason code (requires_subscription, closed_beta, staff_only,
+    monthly_cap_exceeded) surfaced via the X-LLM-Denied-Reason header
 
 4. Configuration (config.go)
   - Manages API keys and provider settings
   - Controls which models are enabled
   - Sets default parameters and limits
+  - CopilotAPIKey() prefers a live token source registered with
+    SetCopilotTokenSource over the static value loaded at startup, so a
+    refreshing source (e.g. copilot-proxy/internal/auth/copilot's OAuth
+    device flow cache) keeps working across long-running processes
 
-5. Token Management (token.go)
+5. Token Management (token.go, keymanager.go, jwks.go)
   - Creates and validates JWT tokens for API authentication
-  - Handles token encryption and signing
+  - Signs with RS256 using KeyManager's rotating ring of keys, publishing
+    public keys at /.well-known/jwks.json so other services can verify
+    tokens without sharing a secret; HS256 with a shared secret remains
+    available behind LLM_JWT_LEGACY_HS256 for migration
   - Manages token lifetime and expiration
 
 # Integration Flow
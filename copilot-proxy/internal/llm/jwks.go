@@ -0,0 +1,30 @@
+package llm
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// JWKSHandler serves the current signing keys in JSON Web Key Set form, so
+// other services can verify RS256 LLM tokens without sharing the private
+// signing key.
+type JWKSHandler struct {
+	keys *KeyManager
+}
+
+// NewJWKSHandler creates a JWKSHandler backed by keys.
+func NewJWKSHandler(keys *KeyManager) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// RegisterHandlers registers the JWKS endpoint with a router.
+func (h *JWKSHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/.well-known/jwks.json", h.handleJWKS)
+}
+
+func (h *JWKSHandler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: h.keys.JWKS()})
+}
@@ -0,0 +1,266 @@
+package llm
+
+import (
+	"copilot-proxy/internal/log"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rsaKeyBits is the modulus size used for generated signing keys.
+const rsaKeyBits = 2048
+
+// keyEntry is one RSA keypair in a KeyManager's ring, identified by kid.
+type keyEntry struct {
+	Kid        string
+	PrivateKey *rsa.PrivateKey
+	CreatedAt  time.Time
+}
+
+// KeyManager holds a rotating ring of RSA keys used to sign and verify RS256
+// LLM tokens. The front of the ring is the currently-active signing key;
+// older keys stay valid for verification until they're retired, so tokens
+// issued just before a rotation don't suddenly fail to validate.
+type KeyManager struct {
+	mu            sync.RWMutex
+	keys          []*keyEntry // front = active
+	rotationEvery time.Duration
+	persistPath   string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewKeyManager creates a KeyManager that rotates its signing key every
+// rotationEvery. If persistPath is non-empty, keys are loaded from it on
+// startup and rewritten after every rotation, so a restart doesn't invalidate
+// tokens signed by the previous process. A fresh key is generated
+// immediately if none were persisted.
+func NewKeyManager(rotationEvery time.Duration, persistPath string) (*KeyManager, error) {
+	km := &KeyManager{
+		rotationEvery: rotationEvery,
+		persistPath:   persistPath,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if persistPath != "" {
+		if err := km.load(); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("loading persisted JWT keys: %w", err)
+		}
+	}
+
+	km.pruneRetired()
+
+	if len(km.keys) == 0 {
+		if err := km.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	go km.runRotation()
+
+	return km, nil
+}
+
+// Close stops the background rotation goroutine.
+func (km *KeyManager) Close() {
+	close(km.stop)
+	<-km.done
+}
+
+// Active returns the kid and private key of the currently-active signing
+// key, or ("", nil) if the ring is somehow empty.
+func (km *KeyManager) Active() (kid string, key *rsa.PrivateKey) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if len(km.keys) == 0 {
+		return "", nil
+	}
+	return km.keys[0].Kid, km.keys[0].PrivateKey
+}
+
+// Lookup returns the public key for kid, for verifying a token signed by a
+// currently-active or recently-retired key.
+func (km *KeyManager) Lookup(kid string) (*rsa.PublicKey, bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	for _, k := range km.keys {
+		if k.Kid == kid {
+			return &k.PrivateKey.PublicKey, true
+		}
+	}
+	return nil, false
+}
+
+// JWK is a single RSA public key in JSON Web Key Set form.
+type JWK struct {
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKS returns every non-retired public key in JWK form, for serving at
+// /.well-known/jwks.json.
+func (km *KeyManager) JWKS() []JWK {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	jwks := make([]JWK, 0, len(km.keys))
+	for _, k := range km.keys {
+		pub := k.PrivateKey.PublicKey
+		jwks = append(jwks, JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			Kid: k.Kid,
+			Alg: "RS256",
+			Use: "sig",
+		})
+	}
+	return jwks
+}
+
+// runRotation generates a new signing key every rotationEvery until Close is
+// called.
+func (km *KeyManager) runRotation() {
+	defer close(km.done)
+
+	ticker := time.NewTicker(km.rotationEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-km.stop:
+			return
+		case <-ticker.C:
+			if err := km.rotate(); err != nil {
+				log.Context().Tag("llm").Err(err).Warn("failed to rotate JWT signing key")
+			}
+		}
+	}
+}
+
+// rotate generates a new RSA key, pushes it to the front of the ring as the
+// new active signing key, retires anything old enough, and persists the
+// result.
+func (km *KeyManager) rotate() error {
+	priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return fmt.Errorf("generating RSA signing key: %w", err)
+	}
+
+	entry := &keyEntry{Kid: NewUUID(), PrivateKey: priv, CreatedAt: time.Now()}
+
+	km.mu.Lock()
+	km.keys = append([]*keyEntry{entry}, km.keys...)
+	km.mu.Unlock()
+
+	km.pruneRetired()
+
+	return km.persist()
+}
+
+// pruneRetired drops keys older than 2x the rotation interval plus
+// TokenLifetime, the longest a token signed by that key could still be
+// unexpired.
+func (km *KeyManager) pruneRetired() {
+	cutoff := time.Now().Add(-(2*km.rotationEvery + TokenLifetime*time.Second))
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	kept := make([]*keyEntry, 0, len(km.keys))
+	for _, k := range km.keys {
+		if k.CreatedAt.After(cutoff) {
+			kept = append(kept, k)
+		}
+	}
+	km.keys = kept
+}
+
+// persistedKey is the on-disk representation of a keyEntry.
+type persistedKey struct {
+	Kid        string    `json:"kid"`
+	PrivateKey string    `json:"private_key_pem"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// persist writes every current key to persistPath as PEM-encoded PKCS1
+// private keys. A no-op if persistPath is empty.
+func (km *KeyManager) persist() error {
+	if km.persistPath == "" {
+		return nil
+	}
+
+	km.mu.RLock()
+	out := make([]persistedKey, 0, len(km.keys))
+	for _, k := range km.keys {
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k.PrivateKey)}
+		out = append(out, persistedKey{
+			Kid:        k.Kid,
+			PrivateKey: string(pem.EncodeToMemory(block)),
+			CreatedAt:  k.CreatedAt,
+		})
+	}
+	km.mu.RUnlock()
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling JWT keys: %w", err)
+	}
+
+	return os.WriteFile(km.persistPath, data, 0o600)
+}
+
+// load reads previously-persisted keys from persistPath into the ring,
+// newest first.
+func (km *KeyManager) load() error {
+	data, err := os.ReadFile(km.persistPath)
+	if err != nil {
+		return err
+	}
+
+	var persisted []persistedKey
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("parsing persisted JWT keys: %w", err)
+	}
+
+	keys := make([]*keyEntry, 0, len(persisted))
+	for _, p := range persisted {
+		block, _ := pem.Decode([]byte(p.PrivateKey))
+		if block == nil {
+			continue
+		}
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &keyEntry{Kid: p.Kid, PrivateKey: priv, CreatedAt: p.CreatedAt})
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	km.mu.Lock()
+	km.keys = keys
+	km.mu.Unlock()
+
+	return nil
+}
+
+var errNoActiveSigningKey = errors.New("no active JWT signing key")
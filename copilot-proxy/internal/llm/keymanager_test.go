@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyManagerRotateInstallsNewActiveKey(t *testing.T) {
+	km := &KeyManager{rotationEvery: time.Hour}
+
+	if err := km.rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	firstKid, firstKey := km.Active()
+	if firstKid == "" || firstKey == nil {
+		t.Fatal("expected rotate to install an active signing key")
+	}
+
+	if err := km.rotate(); err != nil {
+		t.Fatalf("second rotate: %v", err)
+	}
+	secondKid, secondKey := km.Active()
+	if secondKid == firstKid {
+		t.Fatal("expected the second rotate to install a different active key")
+	}
+	if secondKey.Equal(firstKey) {
+		t.Fatal("expected the second rotate to generate a distinct private key")
+	}
+
+	if _, ok := km.Lookup(firstKid); !ok {
+		t.Fatal("expected the previous signing key to remain valid for verification after rotation")
+	}
+}
+
+func TestKeyManagerPruneRetiredDropsKeysPastRetention(t *testing.T) {
+	km := &KeyManager{rotationEvery: time.Minute}
+
+	if err := km.rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	kid, _ := km.Active()
+
+	retention := 2*km.rotationEvery + TokenLifetime*time.Second
+	km.mu.Lock()
+	km.keys[0].CreatedAt = time.Now().Add(-retention - time.Second)
+	km.mu.Unlock()
+
+	km.pruneRetired()
+
+	if _, ok := km.Lookup(kid); ok {
+		t.Fatal("expected a key older than the retention window to be pruned")
+	}
+}
+
+func TestKeyManagerPruneRetiredKeepsKeysWithinRetention(t *testing.T) {
+	km := &KeyManager{rotationEvery: time.Hour}
+
+	if err := km.rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	kid, _ := km.Active()
+
+	km.pruneRetired()
+
+	if _, ok := km.Lookup(kid); !ok {
+		t.Fatal("expected a freshly-rotated key to survive pruneRetired")
+	}
+}
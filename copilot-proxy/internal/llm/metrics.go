@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"copilot-proxy/pkg/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// authDeniedTotal counts every ValidateAccess denial, labeled with the
+	// sentinel error it failed on so operators can alert on a spike in one
+	// specific reason (e.g. ErrRestrictedRegion) instead of "errors" in
+	// general.
+	authDeniedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_auth_denied_total",
+		Help: "LLM access requests denied by ValidateAccess, by reason.",
+	}, []string{"reason", "provider", "model", "country"})
+
+	// requestsTotal counts every request that passes ValidateAccess.
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_requests_total",
+		Help: "LLM requests authorized by ValidateAccess.",
+	}, []string{"provider", "model"})
+
+	// tokensTotal counts tokens recorded via Service.RecordUsage, split by
+	// input/output so prompt and completion costs can be tracked separately.
+	tokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_tokens_total",
+		Help: "Tokens processed per provider and model.",
+	}, []string{"provider", "model", "direction"})
+
+	// spendCentsTotal reports each user's current cumulative monthly spend,
+	// as passed into ValidateAccess. It's a gauge, not a counter, despite the
+	// "_total" name ValidateAccess's doc comment uses: currentSpending is
+	// already a running total tracked elsewhere, not a per-request delta, so
+	// Set is correct here and Add would double-count.
+	spendCentsTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "llm_spend_cents_total",
+		Help: "Current cumulative monthly spend in cents, per user.",
+	}, []string{"user_id"})
+
+	// requestLatency measures wall-clock time spent inside ValidateAccess,
+	// the combined cost of the country, plan, spend, and rate-limit checks.
+	requestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "llm_validate_access_duration_seconds",
+		Help:    "Time spent in ValidateAccess, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "model"})
+)
+
+// auditLog is a dedicated JSON logger for authorization decisions, kept
+// separate from the package-wide log.Context logger since audit events are
+// a compliance record, not an operational one: every field is fixed so it
+// can be queried reliably, and it's never subject to log.SetLevelOverride.
+var auditLog = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// truncatedUserID returns the first 8 hex characters of sha256(userID), so
+// audit events can be correlated across requests for the same user without
+// the log itself carrying the raw, directly-identifying ID.
+func truncatedUserID(userID uint64) string {
+	sum := sha256.Sum256([]byte(strconv.FormatUint(userID, 10)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// errorClass maps a ValidateAccess error to the stable reason string used in
+// both authDeniedTotal and the audit log, so the two can be cross-referenced.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNoCountryCode):
+		return "no_country_code"
+	case errors.Is(err, ErrTorNetwork):
+		return "tor_network"
+	case errors.Is(err, ErrRestrictedRegion):
+		return "restricted_region"
+	case errors.Is(err, ErrModelNotAvailable):
+		return "model_not_available"
+	case errors.Is(err, ErrRateLimitExceeded):
+		return "rate_limit_exceeded"
+	case errors.Is(err, ErrSpendingLimitReached):
+		return "spending_limit_reached"
+	default:
+		return "unknown"
+	}
+}
+
+// recordDenial increments authDeniedTotal and writes a structured audit
+// event for a ValidateAccess denial. country defaults to "unknown" when the
+// request carried no country code at all.
+func recordDenial(err error, token *models.LLMToken, provider models.LanguageModelProvider, modelName, country string) {
+	reason := errorClass(err)
+
+	authDeniedTotal.WithLabelValues(reason, string(provider), modelName, country).Inc()
+
+	auditLog.Warn("llm_auth_denied",
+		"user_id", truncatedUserID(token.UserID),
+		"country", country,
+		"provider", provider,
+		"model", modelName,
+		"error_class", reason,
+	)
+}
+
+// RegisterMetricsHandler wires /metrics onto mux, exposing authDeniedTotal,
+// requestsTotal, tokensTotal, spendCentsTotal, and requestLatency for
+// Prometheus to scrape.
+func RegisterMetricsHandler(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// observeAccessLatency returns a func to defer at the top of ValidateAccess,
+// recording how long the call took in requestLatency.
+func observeAccessLatency(provider models.LanguageModelProvider, modelName string) func() {
+	start := time.Now()
+	return func() {
+		requestLatency.WithLabelValues(string(provider), modelName).Observe(time.Since(start).Seconds())
+	}
+}
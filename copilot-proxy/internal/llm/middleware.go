@@ -0,0 +1,43 @@
+package llm
+
+import (
+	"context"
+	"copilot-proxy/pkg/models"
+	"net/http"
+)
+
+// contextKey is unexported so values set by this package can't collide with
+// context keys set by anything else.
+type contextKey int
+
+const tokenContextKey contextKey = iota
+
+// withToken returns a copy of ctx carrying token, retrievable via
+// tokenFromContext.
+func withToken(ctx context.Context, token *models.LLMToken) context.Context {
+	return context.WithValue(ctx, tokenContextKey, token)
+}
+
+// tokenFromContext returns the token RequireToken validated for this
+// request, if any.
+func tokenFromContext(ctx context.Context) (*models.LLMToken, bool) {
+	token, ok := ctx.Value(tokenContextKey).(*models.LLMToken)
+	return token, ok
+}
+
+// RequireToken validates the request's Authorization header with
+// c.validateToken and, on success, injects the resulting token into the
+// request context before calling next; handlers retrieve it with
+// tokenFromContext instead of calling validateToken themselves. On failure
+// it writes the appropriate 401 response and never calls next.
+func (c *Core) RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := c.validateToken(r)
+		if err != nil {
+			writeTokenError(w, err)
+			return
+		}
+
+		next(w, r.WithContext(withToken(r.Context(), token)))
+	}
+}
@@ -0,0 +1,291 @@
+package llm
+
+import (
+	"bytes"
+	"copilot-proxy/internal/entitlements"
+	"copilot-proxy/internal/log"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	// copilotOpenAIChatURL is GitHub Copilot's OpenAI-compatible chat
+	// completions endpoint.
+	copilotOpenAIChatURL = "https://api.githubcopilot.com/chat/completions"
+
+	// defaultCopilotModel is used when a requested model has no entry in the
+	// translation table.
+	defaultCopilotModel = "gpt-4o"
+)
+
+// defaultModelTranslation maps OpenAI SDK model names to the Copilot Chat
+// model names they should be served as. OPENAI_MODEL_TRANSLATION can extend
+// or override it with a JSON object of the same shape.
+var defaultModelTranslation = map[string]string{
+	"gpt-4":         "gpt-4",
+	"gpt-4o":        "gpt-4o",
+	"gpt-4-turbo":   "gpt-4",
+	"gpt-3.5-turbo": "gpt-4o-mini",
+}
+
+// OpenAIHandler exposes an OpenAI-compatible surface (/v1/chat/completions,
+// /v1/models, /v1/embeddings) backed entirely by GitHub Copilot Chat, so any
+// OpenAI SDK client can point its base URL at this proxy without knowing
+// Copilot is the actual backend. It shares Core's token validation, rate
+// limiter, and usage tracking with the native /completion endpoint.
+type OpenAIHandler struct {
+	core        *Core
+	httpClient  *http.Client
+	translation map[string]string
+}
+
+// NewOpenAIHandler wraps core with the OpenAI-compatible Copilot endpoints.
+func NewOpenAIHandler(core *Core) *OpenAIHandler {
+	return &OpenAIHandler{
+		core:        core,
+		httpClient:  &http.Client{},
+		translation: loadModelTranslation(),
+	}
+}
+
+// loadModelTranslation starts from defaultModelTranslation and overlays
+// OPENAI_MODEL_TRANSLATION, if set, so operators can add or remap models
+// without a code change.
+func loadModelTranslation() map[string]string {
+	table := make(map[string]string, len(defaultModelTranslation))
+	for k, v := range defaultModelTranslation {
+		table[k] = v
+	}
+
+	if raw := os.Getenv("OPENAI_MODEL_TRANSLATION"); raw != "" {
+		var overrides map[string]string
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			log.Context().Tag("llm").Err(err).Warn("ignoring invalid OPENAI_MODEL_TRANSLATION")
+		} else {
+			for k, v := range overrides {
+				table[k] = v
+			}
+		}
+	}
+
+	return table
+}
+
+// translateModel maps an OpenAI SDK model name to the Copilot model name it
+// should be served as, falling back to defaultCopilotModel for anything the
+// table doesn't recognize.
+func (h *OpenAIHandler) translateModel(name string) string {
+	if copilotModel, ok := h.translation[name]; ok {
+		return copilotModel
+	}
+	return defaultCopilotModel
+}
+
+// RegisterHandlers registers the OpenAI-compatible endpoints with a router.
+func (h *OpenAIHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/chat/completions", h.core.RequireToken(h.handleChatCompletions))
+	mux.HandleFunc("/v1/models", h.core.RequireToken(h.handleModels))
+	mux.HandleFunc("/v1/embeddings", h.core.RequireToken(h.handleEmbeddings))
+}
+
+// sanitizeForCopilot drops or narrows OpenAI request fields Copilot Chat
+// rejects: `user` and `logit_bias` aren't supported at all, and
+// `response_format` only survives when it's the plain "text" form.
+func sanitizeForCopilot(body map[string]interface{}) {
+	delete(body, "user")
+	delete(body, "logit_bias")
+
+	if rf, ok := body["response_format"].(map[string]interface{}); ok {
+		if t, _ := rf["type"].(string); t != "text" {
+			delete(body, "response_format")
+		}
+	}
+}
+
+// stripCopilotOnlyFields removes response fields Copilot adds that aren't
+// part of OpenAI's schema, so SDK clients parsing the response don't choke
+// on unrecognized keys.
+func stripCopilotOnlyFields(body map[string]interface{}) {
+	delete(body, "copilot_references")
+	delete(body, "copilot_confirmations")
+}
+
+func (h *OpenAIHandler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	token, _ := tokenFromContext(r.Context())
+
+	if h.core.RateLimiter != nil {
+		allowed, retryAfter, err := h.core.RateLimiter.Allow(token.UserID, "completion", 1)
+		if err != nil {
+			log.Context(tokenContext{token}).Tag("llm").Err(err).Warn("rate limiter check failed, allowing request")
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	requestedModel, _ := body["model"].(string)
+	copilotModel := h.translateModel(requestedModel)
+	body["model"] = copilotModel
+	sanitizeForCopilot(body)
+
+	if err := h.core.checkEntitlements(token, models.ProviderCopilot, copilotModel, entitlements.OpChatCompletion); err != nil {
+		writeEntitlementError(w, err)
+		return
+	}
+
+	usage := h.core.Service.GetModelUsage(token.UserID, models.ProviderCopilot, copilotModel)
+	activeUsers := h.core.Service.GetActiveUserCount(models.ProviderCopilot, copilotModel)
+	countryCode, isTorExit := h.core.resolveCountry(r)
+	if err := ValidateAccess(h.core.RateLimiter, h.core.Service.Registry, token, countryCode, isTorExit, models.ProviderCopilot, copilotModel,
+		usage, activeUsers, 0 /* TODO: wire real monthly spend once available */); err != nil {
+		SetErrorResponseHeaders(w, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	apiKey := GetConfig().CopilotAPIKey()
+	if apiKey == "" {
+		http.Error(w, "Copilot API key not configured", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, copilotOpenAIChatURL, bytes.NewReader(payload))
+	if err != nil {
+		http.Error(w, "failed to build upstream request", http.StatusInternalServerError)
+		return
+	}
+	setCopilotHeaders(req, apiKey)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Copilot request failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	stream, _ := body["stream"].(bool)
+	if stream {
+		h.proxyStream(w, resp, token, copilotModel)
+		return
+	}
+
+	h.proxyCompletion(w, resp, token, copilotModel)
+}
+
+// setCopilotHeaders sets the headers Copilot's API requires beyond a bearer
+// token, matching what VS Code's own Copilot Chat client sends.
+func setCopilotHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Editor-Version", "vscode/1.85.0")
+	req.Header.Set("Copilot-Integration-Id", "vscode-chat")
+	req.Header.Set("Openai-Intent", "conversation-panel")
+}
+
+// flushWriter flushes the underlying ResponseWriter after every write, so an
+// SSE stream reaches the client as it arrives rather than once fully buffered.
+type flushWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// proxyStream copies a streaming Copilot response through to the client
+// byte-for-byte, scanning the same bytes for usage as they pass through so
+// RecordUsage still runs for streamed completions.
+func (h *OpenAIHandler) proxyStream(w http.ResponseWriter, resp *http.Response, token *models.LLMToken, copilotModel string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(resp.StatusCode)
+
+	parser := newSSEUsageParser(models.ProviderCopilot)
+	usageReader := &streamUsageReader{body: resp.Body, parser: parser}
+
+	flusher, _ := w.(http.Flusher)
+	if _, err := io.Copy(flushWriter{w, flusher}, usageReader); err != nil {
+		log.Context(tokenContext{token}).Tag("llm").Err(err).Debug("Copilot SSE stream ended early")
+	}
+
+	h.core.Service.RecordUsage(token.UserID, models.ProviderCopilot, copilotModel, parser.usage())
+}
+
+// proxyCompletion handles a non-streaming Copilot response: it strips
+// Copilot-only fields so the JSON matches OpenAI's schema, records the
+// reported token usage, and forwards the result as-is.
+func (h *OpenAIHandler) proxyCompletion(w http.ResponseWriter, resp *http.Response, token *models.LLMToken, copilotModel string) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid response from Copilot", http.StatusBadGateway)
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if usage, ok := body["usage"].(map[string]interface{}); ok {
+			promptTokens, _ := usage["prompt_tokens"].(float64)
+			completionTokens, _ := usage["completion_tokens"].(float64)
+			h.core.Service.RecordUsage(token.UserID, models.ProviderCopilot, copilotModel, models.TokenUsage{
+				Input:  uint32(promptTokens),
+				Output: uint32(completionTokens),
+			})
+		}
+	}
+
+	stripCopilotOnlyFields(body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+// openAIModel is a model entry in OpenAI's /v1/models response shape.
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (h *OpenAIHandler) handleModels(w http.ResponseWriter, r *http.Request) {
+	data := make([]openAIModel, 0, len(h.translation))
+	for name := range h.translation {
+		data = append(data, openAIModel{ID: name, Object: "model", OwnedBy: "github-copilot"})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Object string        `json:"object"`
+		Data   []openAIModel `json:"data"`
+	}{Object: "list", Data: data})
+}
+
+// handleEmbeddings reports that embeddings aren't available: Copilot Chat
+// has no embeddings endpoint to route to, so faking a response would be
+// worse than telling the client plainly.
+func (h *OpenAIHandler) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "embeddings are not supported by the Copilot Chat backend", http.StatusNotImplemented)
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"copilot-proxy/pkg/models"
+	"net/http"
+)
+
+// Provider adapts one backend LLM API behind a uniform interface, so adding
+// a new backend (Cohere, Mistral, Groq, a local model server) means
+// implementing this and registering it with a Registry, not editing
+// PerformCompletion's call sites.
+type Provider interface {
+	// Name identifies which LanguageModelProvider this implements.
+	Name() models.LanguageModelProvider
+	// Complete sends providerRequest (the raw JSON payload from the
+	// client) to the backend and returns its raw HTTP response. isStaff
+	// lets a provider route staff traffic to a separate key or tier, as
+	// the Anthropic provider does.
+	Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error)
+	// ParseUsage decodes a single streaming chunk's JSON payload for exact
+	// token usage, if that chunk carries it (e.g. OpenAI's terminal usage
+	// frame, Google's usageMetadata). Accumulating usage across a whole
+	// stream, including the delta-text fallback for providers that never
+	// send it, is streamUsageReader's job (see streaming_usage.go); this is
+	// the per-chunk primitive a parser can build on.
+	ParseUsage(chunk []byte) (models.TokenUsage, bool)
+	// NormalizeModel maps a possibly-partial or aliased model name (e.g.
+	// "claude-3-5-sonnet") to the canonical name the backend expects.
+	NormalizeModel(name string) string
+	// SupportsStreaming reports whether Complete's response can be driven
+	// as an SSE stream.
+	SupportsStreaming() bool
+	// AvailableToAllPlans reports whether modelName is available to every
+	// user regardless of subscription plan, generalizing what used to be
+	// hardcoded provider/model checks in AuthorizeAccessToModel (e.g.
+	// Copilot's models are free to all, Anthropic's cheapest Claude tier is
+	// free while its other models aren't).
+	AvailableToAllPlans(modelName string) bool
+}
+
+// Registry maps a LanguageModelProvider to the Provider implementation that
+// handles it, replacing what used to be a switch statement in
+// PerformCompletion.
+type Registry struct {
+	providers map[models.LanguageModelProvider]Provider
+}
+
+// NewRegistry builds an empty Registry; register providers with Register.
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[models.LanguageModelProvider]Provider)}
+}
+
+// Register adds p to the registry, keyed by its own Name(). Registering a
+// second Provider with the same Name replaces the first, so callers can
+// override a built-in provider (e.g. to point OpenAI at a local proxy)
+// without forking this package.
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Name()] = p
+}
+
+// Get returns the Provider registered for name, if any.
+func (r *Registry) Get(name models.LanguageModelProvider) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
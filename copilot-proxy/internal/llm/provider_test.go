@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"copilot-proxy/pkg/models"
+	"net/http"
+	"testing"
+)
+
+// fakeProvider is a minimal Provider for exercising Registry and
+// PerformCompletion's routing without a real backend.
+type fakeProvider struct {
+	name          models.LanguageModelProvider
+	completeCalls int
+	lastRequest   string
+}
+
+func (p *fakeProvider) Name() models.LanguageModelProvider { return p.name }
+
+func (p *fakeProvider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	p.completeCalls++
+	p.lastRequest = providerRequest
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (p *fakeProvider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	return models.TokenUsage{}, false
+}
+func (p *fakeProvider) NormalizeModel(name string) string         { return name }
+func (p *fakeProvider) SupportsStreaming() bool                   { return false }
+func (p *fakeProvider) AvailableToAllPlans(modelName string) bool { return true }
+
+func TestRegistryRegisterAndGet(t *testing.T) {
+	registry := NewRegistry()
+
+	if _, ok := registry.Get(models.ProviderOpenAI); ok {
+		t.Fatal("expected Get on an empty registry to report not-found")
+	}
+
+	fake := &fakeProvider{name: models.ProviderOpenAI}
+	registry.Register(fake)
+
+	got, ok := registry.Get(models.ProviderOpenAI)
+	if !ok {
+		t.Fatal("expected Get to find the just-registered provider")
+	}
+	if got != Provider(fake) {
+		t.Fatal("Get returned a different Provider than the one registered")
+	}
+}
+
+func TestRegistryRegisterOverridesByName(t *testing.T) {
+	registry := NewRegistry()
+
+	first := &fakeProvider{name: models.ProviderOpenAI}
+	second := &fakeProvider{name: models.ProviderOpenAI}
+
+	registry.Register(first)
+	registry.Register(second)
+
+	got, ok := registry.Get(models.ProviderOpenAI)
+	if !ok {
+		t.Fatal("expected Get to find a provider after two registrations")
+	}
+	if got != Provider(second) {
+		t.Fatal("expected the second Register call to replace the first for the same Name")
+	}
+}
+
+func TestFakeProviderRoutesCompleteRequest(t *testing.T) {
+	registry := NewRegistry()
+	fake := &fakeProvider{name: models.ProviderCohere}
+	registry.Register(fake)
+
+	provider, ok := registry.Get(models.ProviderCohere)
+	if !ok {
+		t.Fatal("expected registered Cohere provider to be found")
+	}
+
+	resp, err := provider.Complete(context.Background(), `{"model":"command-r-plus"}`, false)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.StatusCode)
+	}
+	if fake.completeCalls != 1 {
+		t.Fatalf("expected 1 Complete call, got %d", fake.completeCalls)
+	}
+	if fake.lastRequest != `{"model":"command-r-plus"}` {
+		t.Fatalf("unexpected request forwarded to provider: %q", fake.lastRequest)
+	}
+}
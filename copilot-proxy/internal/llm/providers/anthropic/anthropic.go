@@ -0,0 +1,137 @@
+// Package anthropic implements llm.Provider for the Anthropic Messages API.
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// completionURL is Anthropic's Messages endpoint.
+const completionURL = "https://api.anthropic.com/v1/messages"
+
+// modelAliases maps short model names clients commonly send to the dated
+// version Anthropic expects, so a client doesn't need to track Anthropic's
+// release dates.
+var modelAliases = map[string]string{
+	"claude-3-5-sonnet": "claude-3-5-sonnet-20240620",
+	"claude-3-7-sonnet": "claude-3-7-sonnet-20240307",
+	"claude-3-opus":     "claude-3-opus-20240229",
+	"claude-3-haiku":    "claude-3-haiku-20240307",
+	"claude-3-sonnet":   "claude-3-sonnet-20240229",
+}
+
+// Provider routes completions to Anthropic.
+type Provider struct {
+	httpClient  *http.Client
+	apiKey      string
+	staffAPIKey string // used instead of apiKey for staff requests, if set
+}
+
+// New builds a Provider using apiKey for ordinary requests and staffAPIKey
+// (falling back to apiKey if empty) for requests from staff accounts.
+func New(httpClient *http.Client, apiKey, staffAPIKey string) *Provider {
+	return &Provider{httpClient: httpClient, apiKey: apiKey, staffAPIKey: staffAPIKey}
+}
+
+// Name implements llm.Provider.
+func (p *Provider) Name() models.LanguageModelProvider { return models.ProviderAnthropic }
+
+// Complete implements llm.Provider.
+func (p *Provider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	apiKey := p.apiKey
+	if isStaff && p.staffAPIKey != "" {
+		apiKey = p.staffAPIKey
+	}
+	if apiKey == "" {
+		return nil, errors.New("Anthropic API key not configured")
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
+		return nil, err
+	}
+
+	if model, ok := requestData["model"].(string); ok {
+		requestData["model"] = p.NormalizeModel(model)
+	}
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, completionURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	return p.httpClient.Do(req)
+}
+
+// streamEvent is the subset of an Anthropic Messages streaming event
+// ParseUsage looks at: message_start carries input_tokens, message_delta
+// carries the running output_tokens total.
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage struct {
+			InputTokens uint32 `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Usage struct {
+		OutputTokens uint32 `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// ParseUsage implements llm.Provider. Older API versions omit
+// message_delta's usage; when that happens, the caller's delta-text
+// fallback takes over for the output count.
+func (p *Provider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	var event streamEvent
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return models.TokenUsage{}, false
+	}
+
+	switch event.Type {
+	case "message_start":
+		return models.TokenUsage{Input: event.Message.Usage.InputTokens}, true
+	case "message_delta":
+		if event.Usage.OutputTokens > 0 {
+			return models.TokenUsage{Output: event.Usage.OutputTokens}, true
+		}
+	}
+	return models.TokenUsage{}, false
+}
+
+// NormalizeModel implements llm.Provider, rewriting a short model name to
+// the dated version Anthropic expects.
+func (p *Provider) NormalizeModel(name string) string {
+	if canonical, ok := modelAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// SupportsStreaming implements llm.Provider.
+func (p *Provider) SupportsStreaming() bool { return true }
+
+// freeTierModels are the Claude models available to every user regardless
+// of plan, keyed by the canonical (post-NormalizeModel) name and the short
+// aliases that resolve to them.
+var freeTierModels = map[string]bool{
+	"claude-3-5-sonnet": true,
+	"claude-3-7-sonnet": true,
+}
+
+// AvailableToAllPlans implements llm.Provider.
+func (p *Provider) AvailableToAllPlans(modelName string) bool {
+	return freeTierModels[modelName]
+}
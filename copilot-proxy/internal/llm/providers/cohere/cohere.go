@@ -0,0 +1,97 @@
+// Package cohere implements llm.Provider for Cohere's Chat API.
+package cohere
+
+import (
+	"bytes"
+	"context"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// chatURL is Cohere's chat completions endpoint.
+const chatURL = "https://api.cohere.com/v2/chat"
+
+// Provider routes completions to Cohere.
+type Provider struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+// New builds a Provider using apiKey for every request.
+func New(httpClient *http.Client, apiKey string) *Provider {
+	return &Provider{httpClient: httpClient, apiKey: apiKey}
+}
+
+// Name implements llm.Provider.
+func (p *Provider) Name() models.LanguageModelProvider { return models.ProviderCohere }
+
+// Complete implements llm.Provider.
+func (p *Provider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	if p.apiKey == "" {
+		return nil, errors.New("Cohere API key not configured")
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
+		return nil, err
+	}
+
+	if model, ok := requestData["model"].(string); ok {
+		requestData["model"] = p.NormalizeModel(model)
+	}
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, chatURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	return p.httpClient.Do(req)
+}
+
+// streamEvent is the subset of a Cohere streaming event ParseUsage looks
+// at: the terminal "message-end" event carries the full usage tally.
+type streamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Usage struct {
+			Tokens struct {
+				InputTokens  uint32 `json:"input_tokens"`
+				OutputTokens uint32 `json:"output_tokens"`
+			} `json:"tokens"`
+		} `json:"usage"`
+	} `json:"delta"`
+}
+
+// ParseUsage implements llm.Provider.
+func (p *Provider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	var event streamEvent
+	if err := json.Unmarshal(chunk, &event); err != nil || event.Type != "message-end" {
+		return models.TokenUsage{}, false
+	}
+
+	tokens := event.Delta.Usage.Tokens
+	if tokens.InputTokens == 0 && tokens.OutputTokens == 0 {
+		return models.TokenUsage{}, false
+	}
+
+	return models.TokenUsage{Input: tokens.InputTokens, Output: tokens.OutputTokens}, true
+}
+
+// NormalizeModel implements llm.Provider. Cohere takes model names as given.
+func (p *Provider) NormalizeModel(name string) string { return name }
+
+// SupportsStreaming implements llm.Provider.
+func (p *Provider) SupportsStreaming() bool { return true }
+
+// AvailableToAllPlans implements llm.Provider. Cohere has no free tier.
+func (p *Provider) AvailableToAllPlans(modelName string) bool { return false }
@@ -0,0 +1,105 @@
+// Package copilot implements llm.Provider for GitHub Copilot Chat. It's
+// unrelated to copilot-proxy/internal/auth/copilot, which handles this
+// server's own OAuth login to GitHub Copilot rather than proxying chat
+// completions for end users.
+package copilot
+
+import (
+	"bytes"
+	"context"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// chatCompletionURL is GitHub Copilot's chat completions endpoint.
+const chatCompletionURL = "https://api.githubcopilot.com/chat/completions"
+
+// The following identify this proxy to GitHub's Copilot endpoint as a
+// recognized client, the same way the OAuth token exchange in
+// internal/auth/copilot does.
+const (
+	editorVersion        = "vscode/1.85.0"
+	editorPluginVersion  = "copilot-chat/0.12.0"
+	copilotIntegrationID = "vscode-chat"
+	copilotUserAgent     = "GithubCopilot/1.155.0"
+)
+
+// Provider routes completions to GitHub Copilot Chat.
+type Provider struct {
+	apiKey func() string
+}
+
+// New builds a Provider that reads its API key from apiKey on every call,
+// rather than capturing a static string, so it keeps working if
+// llm.SetCopilotTokenSource later swaps in a refreshing OAuth-derived key.
+func New(apiKey func() string) *Provider {
+	return &Provider{apiKey: apiKey}
+}
+
+// Name implements llm.Provider.
+func (p *Provider) Name() models.LanguageModelProvider { return models.ProviderCopilot }
+
+// Complete implements llm.Provider.
+func (p *Provider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	apiKey := p.apiKey()
+	if apiKey == "" {
+		return nil, errors.New("Copilot API key not configured")
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, chatCompletionURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Editor-Version", editorVersion)
+	req.Header.Set("Editor-Plugin-Version", editorPluginVersion)
+	req.Header.Set("Copilot-Integration-Id", copilotIntegrationID)
+	req.Header.Set("User-Agent", copilotUserAgent)
+
+	return http.DefaultClient.Do(req)
+}
+
+// streamChunk is the subset of a Copilot/OpenAI-shaped streaming chunk
+// ParseUsage looks at.
+type streamChunk struct {
+	Usage *struct {
+		PromptTokens     uint32 `json:"prompt_tokens"`
+		CompletionTokens uint32 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// ParseUsage implements llm.Provider. Copilot doesn't consistently send a
+// terminal usage frame; when it's absent, the caller's delta-text fallback
+// takes over.
+func (p *Provider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	var c streamChunk
+	if err := json.Unmarshal(chunk, &c); err != nil || c.Usage == nil {
+		return models.TokenUsage{}, false
+	}
+	return models.TokenUsage{Input: c.Usage.PromptTokens, Output: c.Usage.CompletionTokens}, true
+}
+
+// NormalizeModel implements llm.Provider. Copilot takes model names as
+// given.
+func (p *Provider) NormalizeModel(name string) string { return name }
+
+// SupportsStreaming implements llm.Provider.
+func (p *Provider) SupportsStreaming() bool { return true }
+
+// AvailableToAllPlans implements llm.Provider. Every Copilot model is
+// available to any user with a valid token, regardless of plan.
+func (p *Provider) AvailableToAllPlans(modelName string) bool { return true }
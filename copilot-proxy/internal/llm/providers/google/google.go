@@ -0,0 +1,92 @@
+// Package google implements llm.Provider for the Google AI generateContent
+// API.
+package google
+
+import (
+	"bytes"
+	"context"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// completionBaseURL is Google AI's generateContent endpoint, missing only
+// the model name and API key.
+const completionBaseURL = "https://generativelanguage.googleapis.com/v1/models"
+
+// Provider routes completions to Google AI.
+type Provider struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+// New builds a Provider using apiKey for every request.
+func New(httpClient *http.Client, apiKey string) *Provider {
+	return &Provider{httpClient: httpClient, apiKey: apiKey}
+}
+
+// Name implements llm.Provider.
+func (p *Provider) Name() models.LanguageModelProvider { return models.ProviderGoogle }
+
+// Complete implements llm.Provider.
+func (p *Provider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	if p.apiKey == "" {
+		return nil, errors.New("Google AI API key not configured")
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
+		return nil, err
+	}
+
+	model, ok := requestData["model"].(string)
+	if !ok {
+		return nil, errors.New("missing model in request")
+	}
+
+	url := fmt.Sprintf("%s/%s:generateContent?key=%s", completionBaseURL, model, p.apiKey)
+
+	body, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return p.httpClient.Do(req)
+}
+
+// streamChunk is the subset of a Google AI streaming chunk ParseUsage looks
+// at.
+type streamChunk struct {
+	UsageMetadata *struct {
+		PromptTokenCount     uint32 `json:"promptTokenCount"`
+		CandidatesTokenCount uint32 `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// ParseUsage implements llm.Provider.
+func (p *Provider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	var c streamChunk
+	if err := json.Unmarshal(chunk, &c); err != nil || c.UsageMetadata == nil {
+		return models.TokenUsage{}, false
+	}
+	return models.TokenUsage{Input: c.UsageMetadata.PromptTokenCount, Output: c.UsageMetadata.CandidatesTokenCount}, true
+}
+
+// NormalizeModel implements llm.Provider. Google AI takes model names as
+// given.
+func (p *Provider) NormalizeModel(name string) string { return name }
+
+// SupportsStreaming implements llm.Provider.
+func (p *Provider) SupportsStreaming() bool { return true }
+
+// AvailableToAllPlans implements llm.Provider. Google AI has no free tier.
+func (p *Provider) AvailableToAllPlans(modelName string) bool { return false }
@@ -0,0 +1,71 @@
+// Package openai implements llm.Provider for the OpenAI chat completions
+// API.
+package openai
+
+import (
+	"context"
+	"copilot-proxy/pkg/models"
+	"copilot-proxy/pkg/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// chatCompletionURL is OpenAI's chat completions endpoint.
+const chatCompletionURL = "https://api.openai.com/v1/chat/completions"
+
+// Provider routes completions to OpenAI.
+type Provider struct {
+	apiKey string
+}
+
+// New builds a Provider using apiKey for every request.
+func New(apiKey string) *Provider {
+	return &Provider{apiKey: apiKey}
+}
+
+// Name implements llm.Provider.
+func (p *Provider) Name() models.LanguageModelProvider { return models.ProviderOpenAI }
+
+// Complete implements llm.Provider.
+func (p *Provider) Complete(ctx context.Context, providerRequest string, isStaff bool) (*http.Response, error) {
+	if p.apiKey == "" {
+		return nil, errors.New("OpenAI API key not configured")
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
+		return nil, err
+	}
+
+	return utils.CallAPIWithBody(chatCompletionURL, "application/json", p.apiKey, requestData)
+}
+
+// streamChunk is the subset of an OpenAI streaming chunk ParseUsage looks
+// at: the terminal frame sent when the request set
+// stream_options.include_usage.
+type streamChunk struct {
+	Usage *struct {
+		PromptTokens     uint32 `json:"prompt_tokens"`
+		CompletionTokens uint32 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// ParseUsage implements llm.Provider.
+func (p *Provider) ParseUsage(chunk []byte) (models.TokenUsage, bool) {
+	var c streamChunk
+	if err := json.Unmarshal(chunk, &c); err != nil || c.Usage == nil {
+		return models.TokenUsage{}, false
+	}
+	return models.TokenUsage{Input: c.Usage.PromptTokens, Output: c.Usage.CompletionTokens}, true
+}
+
+// NormalizeModel implements llm.Provider. OpenAI takes model names as
+// given.
+func (p *Provider) NormalizeModel(name string) string { return name }
+
+// SupportsStreaming implements llm.Provider.
+func (p *Provider) SupportsStreaming() bool { return true }
+
+// AvailableToAllPlans implements llm.Provider. OpenAI has no free tier.
+func (p *Provider) AvailableToAllPlans(modelName string) bool { return false }
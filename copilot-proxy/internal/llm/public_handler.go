@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"copilot-proxy/internal/entitlements"
+	"copilot-proxy/internal/log"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// PublicHandler exposes the end-user-facing LLM endpoints: listing
+// accessible models and running completions, each gated by token validation
+// and the Core's per-user rate limiter.
+type PublicHandler struct {
+	core *Core
+}
+
+// NewPublicHandler wraps core with the public /models and /completion endpoints.
+func NewPublicHandler(core *Core) *PublicHandler {
+	return &PublicHandler{core: core}
+}
+
+// ListModelsResponse is the response for the list models endpoint
+type ListModelsResponse struct {
+	Models []models.LanguageModel `json:"models"`
+}
+
+// CompletionParams are the parameters for a completion request
+type CompletionParams struct {
+	Provider        models.LanguageModelProvider `json:"provider"`
+	Model           string                       `json:"model"`
+	ProviderRequest string                       `json:"provider_request"` // Raw JSON payload
+}
+
+// Context implements log.Contexter so completion log lines are tagged with
+// the provider and model involved.
+func (p CompletionParams) Context() map[string]any {
+	return map[string]any{
+		"provider": p.Provider,
+		"model":    p.Model,
+	}
+}
+
+// tokenContext adapts a *models.LLMToken into a log.Contexter, since models
+// is a dependency the llm package doesn't own and can't add methods to.
+type tokenContext struct {
+	token *models.LLMToken
+}
+
+func (t tokenContext) Context() map[string]any {
+	return map[string]any{"user_id": t.token.UserID}
+}
+
+// HandleListModels handles the list models endpoint
+func (h *PublicHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	token, _ := tokenFromContext(r.Context())
+
+	countryCode, isTorExit := h.core.resolveCountry(r)
+
+	availableModels := DefaultModels()
+	var accessibleModels []models.LanguageModel
+
+	for _, model := range availableModels {
+		// Check if model is accessible from this country code
+		if err := AuthorizeAccessForCountry(countryCode, isTorExit, model.Provider); err == nil {
+			// Check if model is available in the user's plan
+			if err := AuthorizeAccessToModel(h.core.Service.Registry, token, model.Provider, model.Name); err == nil {
+				accessibleModels = append(accessibleModels, model)
+			}
+		}
+	}
+
+	response := ListModelsResponse{
+		Models: accessibleModels,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleCompletion handles the completion endpoint
+func (h *PublicHandler) HandleCompletion(w http.ResponseWriter, r *http.Request) {
+	token, _ := tokenFromContext(r.Context())
+
+	if h.core.RateLimiter != nil {
+		allowed, retryAfter, err := h.core.RateLimiter.Allow(token.UserID, "completion", 1)
+		if err != nil {
+			log.Context(tokenContext{token}).Tag("llm").Err(err).Warn("rate limiter check failed, allowing request")
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var params CompletionParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.core.checkEntitlements(token, params.Provider, params.Model, entitlements.OpChatCompletion); err != nil {
+		writeEntitlementError(w, err)
+		return
+	}
+
+	countryCode, isTorExit := h.core.resolveCountry(r)
+
+	// In a real implementation, we would fetch the current spending from a database
+	// Here we'll use a placeholder value
+	currentSpending := uint32(0)
+
+	req := CompletionRequest{
+		Provider:        params.Provider,
+		Model:           params.Model,
+		ProviderRequest: params.ProviderRequest,
+		Token:           token,
+		CountryCode:     countryCode,
+		IsTorExit:       isTorExit,
+		CurrentSpending: currentSpending,
+	}
+
+	resp, err := h.core.Service.PerformCompletion(req)
+	if err != nil {
+		SetErrorResponseHeaders(w, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	// Set up streaming response
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Process and stream the response
+	reader, err := h.core.Service.ProcessStreamingResponse(resp, token.UserID, params.Provider, params.Model)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer reader.Close()
+
+	// Copy the reader to the response writer
+	_, err = io.Copy(w, reader)
+	if err != nil {
+		log.Context(params, tokenContext{token}).Tag("llm").Err(err).Debug("streaming completion response ended early")
+		return
+	}
+}
+
+// RegisterHandlers registers the public LLM handlers with a router
+func (h *PublicHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/models", h.core.RequireToken(h.HandleListModels))
+	mux.HandleFunc("/completion", h.core.RequireToken(h.HandleCompletion))
+}
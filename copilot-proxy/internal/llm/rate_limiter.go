@@ -0,0 +1,248 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"copilot-proxy/pkg/models"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitLookup resolves the capacity and refill window for a bucket key,
+// so a RateLimiter implementation doesn't need to know about models or
+// DefaultModels() itself. ok is false for a key with no configured limit,
+// in which case callers should allow the request unconditionally.
+type RateLimitLookup func(key string) (capacity int, refillEvery time.Duration, ok bool)
+
+// RateLimitForKey is the default RateLimitLookup for keys CheckRateLimit
+// builds, of the form "<provider>:<model>:<window>". It resolves the model
+// in DefaultModels() and maps window to the matching MaxXPerY field.
+func RateLimitForKey(key string) (capacity int, refillEvery time.Duration, ok bool) {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	provider, modelName, window := models.LanguageModelProvider(parts[0]), parts[1], parts[2]
+
+	for _, m := range DefaultModels() {
+		if m.Provider != provider || m.Name != modelName {
+			continue
+		}
+
+		switch window {
+		case "requests_per_minute":
+			return m.MaxRequestsPerMinute, time.Minute, true
+		case "tokens_per_minute":
+			return m.MaxTokensPerMinute, time.Minute, true
+		case "input_tokens_per_minute":
+			return m.MaxInputTokensPerMinute, time.Minute, true
+		case "output_tokens_per_minute":
+			return m.MaxOutputTokensPerMinute, time.Minute, true
+		case "tokens_per_day":
+			return m.MaxTokensPerDay, 24 * time.Hour, true
+		default:
+			return 0, 0, false
+		}
+	}
+
+	return 0, 0, false
+}
+
+// defaultMaxBuckets caps how many distinct (userID, key) limiters an
+// InProcessRateLimiter keeps in memory before evicting the least recently
+// used one.
+const defaultMaxBuckets = 100_000
+
+// inProcessEntry is one bucket cached by InProcessRateLimiter, keeping its
+// key alongside the limiter so the LRU list can report what to delete from
+// the index on eviction.
+type inProcessEntry struct {
+	bucketKey string
+	limiter   *rate.Limiter
+}
+
+// InProcessRateLimiter is a RateLimiter backed by a golang.org/x/time/rate
+// limiter per (userID, key), with least-recently-used eviction so memory
+// doesn't grow unbounded across every user and model a single process ever
+// sees. It enforces limits only within this process; use RedisRateLimiter
+// to share state across a multi-instance deployment.
+type InProcessRateLimiter struct {
+	lookup     RateLimitLookup
+	maxBuckets int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+}
+
+// NewInProcessRateLimiter creates an InProcessRateLimiter resolving each
+// bucket's capacity and refill window from lookup (RateLimitForKey, for
+// CheckRateLimit's keys) and keeping at most maxBuckets idle buckets cached;
+// maxBuckets <= 0 defaults to 100,000.
+func NewInProcessRateLimiter(lookup RateLimitLookup, maxBuckets int) *InProcessRateLimiter {
+	if maxBuckets <= 0 {
+		maxBuckets = defaultMaxBuckets
+	}
+
+	return &InProcessRateLimiter{
+		lookup:     lookup,
+		maxBuckets: maxBuckets,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Allow implements RateLimiter.
+func (l *InProcessRateLimiter) Allow(userID uint64, key string, cost int) (bool, time.Duration, error) {
+	capacity, refillEvery, ok := l.lookup(key)
+	if !ok || capacity <= 0 {
+		return true, 0, nil
+	}
+
+	bucketKey := fmt.Sprintf("%d:%s", userID, key)
+
+	l.mu.Lock()
+	limiter := l.limiterFor(bucketKey, capacity, refillEvery)
+	l.mu.Unlock()
+
+	reservation := limiter.ReserveN(time.Now(), cost)
+	if !reservation.OK() {
+		return false, 0, fmt.Errorf("requested cost %d exceeds bucket capacity %d for %q", cost, capacity, key)
+	}
+
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, delay, nil
+	}
+
+	return true, 0, nil
+}
+
+// limiterFor returns the rate.Limiter for bucketKey, creating one at full
+// capacity on first use and evicting the least recently used bucket if
+// l.maxBuckets is exceeded. Callers must hold l.mu.
+func (l *InProcessRateLimiter) limiterFor(bucketKey string, capacity int, refillEvery time.Duration) *rate.Limiter {
+	if elem, ok := l.entries[bucketKey]; ok {
+		l.order.MoveToFront(elem)
+		return elem.Value.(*inProcessEntry).limiter
+	}
+
+	limiter := rate.NewLimiter(rate.Every(refillEvery/time.Duration(capacity)), capacity)
+	elem := l.order.PushFront(&inProcessEntry{bucketKey: bucketKey, limiter: limiter})
+	l.entries[bucketKey] = elem
+
+	if l.order.Len() > l.maxBuckets {
+		if oldest := l.order.Back(); oldest != nil {
+			l.order.Remove(oldest)
+			delete(l.entries, oldest.Value.(*inProcessEntry).bucketKey)
+		}
+	}
+
+	return limiter
+}
+
+// RedisScripter is the narrow slice of a Redis client RedisRateLimiter
+// needs: evaluating a Lua script. It's defined locally, mirroring
+// UsageStore's RedisClient in copilot-proxy/internal/llm, so this package
+// doesn't depend on a specific Redis driver.
+type RedisScripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// tokenBucketScript atomically refills and, if there's enough left,
+// decrements a token bucket stored as a Redis hash of {tokens, ts}, so two
+// concurrent requests against the same key can never both observe enough
+// headroom and both proceed. Returns {allowed (0/1), retry_after_seconds}.
+const tokenBucketScript = `
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local refill_per_sec = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local data = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil then
+  tokens = capacity
+  ts = now
+end
+
+local elapsed = math.max(now - ts, 0)
+tokens = math.min(capacity, tokens + elapsed * refill_per_sec)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+elseif refill_per_sec > 0 then
+  retry_after = math.ceil((cost - tokens) / refill_per_sec)
+end
+
+redis.call("HMSET", key, "tokens", tokens, "ts", now)
+redis.call("EXPIRE", key, math.ceil(capacity / math.max(refill_per_sec, 0.001)) * 2)
+
+return {allowed, retry_after}
+`
+
+// RedisRateLimiter is a RateLimiter backed by Redis, so every instance in a
+// multi-instance deployment enforces the same buckets instead of each
+// process tracking its own. Bucket capacity and refill rate come from
+// lookup, the same as InProcessRateLimiter.
+type RedisRateLimiter struct {
+	client    RedisScripter
+	lookup    RateLimitLookup
+	keyPrefix string
+}
+
+// NewRedisRateLimiter creates a RedisRateLimiter. keyPrefix namespaces its
+// Redis keys (e.g. "llm:ratelimit:") so they don't collide with other uses
+// of the same Redis instance.
+func NewRedisRateLimiter(client RedisScripter, lookup RateLimitLookup, keyPrefix string) *RedisRateLimiter {
+	return &RedisRateLimiter{client: client, lookup: lookup, keyPrefix: keyPrefix}
+}
+
+// Allow implements RateLimiter.
+func (l *RedisRateLimiter) Allow(userID uint64, key string, cost int) (bool, time.Duration, error) {
+	capacity, refillEvery, ok := l.lookup(key)
+	if !ok || capacity <= 0 {
+		return true, 0, nil
+	}
+
+	refillPerSec := float64(capacity) / refillEvery.Seconds()
+	bucketKey := fmt.Sprintf("%s%d:%s", l.keyPrefix, userID, key)
+
+	result, err := l.client.Eval(context.Background(), tokenBucketScript, []string{bucketKey},
+		capacity, refillPerSec, cost, time.Now().Unix())
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limiter: %w", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("rate limiter: unexpected script result %v", result)
+	}
+
+	allowed, _ := toInt64(values[0])
+	retryAfterSeconds, _ := toInt64(values[1])
+
+	return allowed == 1, time.Duration(retryAfterSeconds) * time.Second, nil
+}
+
+// toInt64 converts a Lua script's numeric return value to int64 regardless
+// of which concrete integer type a given Redis driver decodes it as.
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
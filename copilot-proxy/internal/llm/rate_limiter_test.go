@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func staticLookup(capacity int, refillEvery time.Duration) RateLimitLookup {
+	return func(key string) (int, time.Duration, bool) {
+		return capacity, refillEvery, true
+	}
+}
+
+func TestInProcessRateLimiterAllowsUpToCapacityThenDenies(t *testing.T) {
+	limiter := NewInProcessRateLimiter(staticLookup(3, time.Minute), 0)
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := limiter.Allow(1, "openai:gpt-4:requests_per_minute", 1)
+		if err != nil {
+			t.Fatalf("Allow %d: %v", i, err)
+		}
+		if !allowed {
+			t.Fatalf("expected request %d to be allowed within capacity", i)
+		}
+	}
+
+	allowed, retryAfter, err := limiter.Allow(1, "openai:gpt-4:requests_per_minute", 1)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if allowed {
+		t.Fatal("expected the 4th request to be denied once capacity is exhausted")
+	}
+	if retryAfter <= 0 {
+		t.Fatal("expected a positive retryAfter once denied")
+	}
+}
+
+func TestInProcessRateLimiterTracksUsersIndependently(t *testing.T) {
+	limiter := NewInProcessRateLimiter(staticLookup(1, time.Minute), 0)
+
+	allowed, _, err := limiter.Allow(1, "openai:gpt-4:requests_per_minute", 1)
+	if err != nil || !allowed {
+		t.Fatalf("expected user 1's first request to be allowed: allowed=%v err=%v", allowed, err)
+	}
+
+	allowed, _, err = limiter.Allow(2, "openai:gpt-4:requests_per_minute", 1)
+	if err != nil || !allowed {
+		t.Fatalf("expected user 2's first request to be allowed independently of user 1: allowed=%v err=%v", allowed, err)
+	}
+
+	allowed, _, err = limiter.Allow(1, "openai:gpt-4:requests_per_minute", 1)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if allowed {
+		t.Fatal("expected user 1's second request to be denied, capacity is 1")
+	}
+}
+
+func TestInProcessRateLimiterSkipsUnconfiguredKeys(t *testing.T) {
+	limiter := NewInProcessRateLimiter(func(key string) (int, time.Duration, bool) {
+		return 0, 0, false
+	}, 0)
+
+	allowed, _, err := limiter.Allow(1, "unknown:model:requests_per_minute", 1)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if !allowed {
+		t.Fatal("expected a key with no configured limit to be allowed unconditionally")
+	}
+}
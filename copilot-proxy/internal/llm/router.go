@@ -0,0 +1,313 @@
+package llm
+
+import (
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// RoutingStrategy picks the order Router tries a route's targets in.
+type RoutingStrategy string
+
+const (
+	// StrategyPriority tries targets in the order they're listed.
+	StrategyPriority RoutingStrategy = "priority"
+	// StrategyRoundRobin rotates the starting target on every call.
+	StrategyRoundRobin RoutingStrategy = "round_robin"
+	// StrategyLeastLatency tries the target with the lowest last observed
+	// latency first; targets with no recorded latency yet sort first.
+	StrategyLeastLatency RoutingStrategy = "least_latency"
+)
+
+// RouteTarget is one (provider, model) pair a logical model can fall back
+// across.
+type RouteTarget struct {
+	Provider  models.LanguageModelProvider `json:"provider"`
+	Model     string                       `json:"model"`
+	Weight    int                          `json:"weight"`
+	TimeoutMS int                          `json:"timeout_ms"`
+}
+
+// RouteConfig describes how a single logical model (e.g. "chat-large") is
+// routed across its fallback targets.
+type RouteConfig struct {
+	LogicalModel string          `json:"logical_model"`
+	Strategy     RoutingStrategy `json:"strategy"`
+	Targets      []RouteTarget   `json:"targets"`
+}
+
+// RoutingTable is the declarative routing configuration loaded at startup.
+type RoutingTable struct {
+	Routes []RouteConfig `json:"routes"`
+}
+
+// LoadRoutingTable reads and parses a RoutingTable from a JSON file at path.
+func LoadRoutingTable(path string) (*RoutingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading routing table: %w", err)
+	}
+
+	var table RoutingTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parsing routing table: %w", err)
+	}
+	return &table, nil
+}
+
+// RoutingTableFromEnv loads the routing table referenced by the
+// LLM_ROUTING_CONFIG_PATH environment variable, if set. It returns a nil
+// table and nil error when the variable is unset, so routing is simply
+// unused until an operator opts in.
+func RoutingTableFromEnv() (*RoutingTable, error) {
+	path := os.Getenv("LLM_ROUTING_CONFIG_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadRoutingTable(path)
+}
+
+// targetHealth is HealthTracker's per-target bookkeeping.
+type targetHealth struct {
+	consecutiveFailures int
+	openUntil           time.Time
+	lastLatency         time.Duration
+	hasLatency          bool
+}
+
+// HealthTracker maintains a circuit breaker per RouteTarget: after
+// failureThreshold consecutive failures, or a single unauthorized response,
+// the target is considered unhealthy for cooldown before Router will try it
+// again.
+type HealthTracker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	cooldown         time.Duration
+	targets          map[string]*targetHealth
+}
+
+// NewHealthTracker builds a HealthTracker that opens a target's circuit
+// after failureThreshold consecutive failures, closed for cooldown.
+func NewHealthTracker(failureThreshold int, cooldown time.Duration) *HealthTracker {
+	return &HealthTracker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		targets:          make(map[string]*targetHealth),
+	}
+}
+
+func targetKey(t RouteTarget) string {
+	return string(t.Provider) + ":" + t.Model
+}
+
+func (h *HealthTracker) entry(t RouteTarget) *targetHealth {
+	key := targetKey(t)
+	th, ok := h.targets[key]
+	if !ok {
+		th = &targetHealth{}
+		h.targets[key] = th
+	}
+	return th
+}
+
+// Healthy reports whether t's circuit is currently closed.
+func (h *HealthTracker) Healthy(t RouteTarget) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.entry(t)
+	return th.openUntil.IsZero() || !time.Now().Before(th.openUntil)
+}
+
+// RecordSuccess closes t's circuit and resets its failure count.
+func (h *HealthTracker) RecordSuccess(t RouteTarget, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.entry(t)
+	th.consecutiveFailures = 0
+	th.openUntil = time.Time{}
+	th.lastLatency = latency
+	th.hasLatency = true
+}
+
+// RecordFailure counts a failed call against t, opening its circuit for
+// cooldown once failureThreshold consecutive failures accumulate.
+func (h *HealthTracker) RecordFailure(t RouteTarget) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.entry(t)
+	th.consecutiveFailures++
+	if th.consecutiveFailures >= h.failureThreshold {
+		th.openUntil = time.Now().Add(h.cooldown)
+	}
+}
+
+// RecordUnauthorized opens t's circuit for cooldown immediately, regardless
+// of failureThreshold: a rejected credential won't start working on retry.
+func (h *HealthTracker) RecordUnauthorized(t RouteTarget) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.entry(t)
+	th.openUntil = time.Now().Add(h.cooldown)
+}
+
+func (h *HealthTracker) latency(t RouteTarget) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.entry(t)
+	return th.lastLatency, th.hasLatency
+}
+
+// ErrNoRouteConfigured is returned when Router.Complete is asked to route a
+// logical model with no matching entry in its RoutingTable.
+var ErrNoRouteConfigured = errors.New("no route configured for model")
+
+// ErrAllTargetsUnhealthy is returned when every target for a logical model
+// is currently circuit-broken or returned a retryable failure.
+var ErrAllTargetsUnhealthy = errors.New("all route targets unhealthy or exhausted")
+
+// Router selects among a logical model's fallback targets, skipping any the
+// HealthTracker considers unhealthy, and falls back to the next target when
+// a call fails with a retryable error (5xx, 429, or a connection error).
+// Non-retryable errors (e.g. ErrAccountTooYoung, a denied entitlement) are
+// returned immediately without trying further targets.
+type Router struct {
+	service *Service
+	health  *HealthTracker
+	routes  map[string]RouteConfig
+
+	rrMu    sync.Mutex
+	rrIndex map[string]int
+}
+
+// NewRouter builds a Router that completes requests through service,
+// falling back across table's targets and tracking health with health.
+func NewRouter(service *Service, table *RoutingTable, health *HealthTracker) *Router {
+	routes := make(map[string]RouteConfig)
+	if table != nil {
+		for _, route := range table.Routes {
+			routes[route.LogicalModel] = route
+		}
+	}
+	return &Router{
+		service: service,
+		health:  health,
+		routes:  routes,
+		rrIndex: make(map[string]int),
+	}
+}
+
+// Complete routes req to the first healthy, successful target configured
+// for logicalModel, falling back across the remaining targets on a
+// retryable failure.
+func (router *Router) Complete(logicalModel string, req CompletionRequest) (*http.Response, error) {
+	route, ok := router.routes[logicalModel]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRouteConfigured, logicalModel)
+	}
+
+	var lastErr error
+	for _, target := range router.orderedTargets(route) {
+		if !router.health.Healthy(target) {
+			continue
+		}
+
+		targetReq := req
+		targetReq.Provider = target.Provider
+		targetReq.Model = target.Model
+
+		start := time.Now()
+		resp, err := router.service.PerformCompletion(targetReq)
+		if err != nil {
+			if isRetryableErr(err) {
+				router.health.RecordFailure(target)
+				lastErr = err
+				continue
+			}
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			resp.Body.Close()
+			router.health.RecordUnauthorized(target)
+			lastErr = fmt.Errorf("%s:%s: unauthorized", target.Provider, target.Model)
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+			resp.Body.Close()
+			router.health.RecordFailure(target)
+			lastErr = fmt.Errorf("%s:%s: status %d", target.Provider, target.Model, resp.StatusCode)
+		default:
+			router.health.RecordSuccess(target, time.Since(start))
+			return resp, nil
+		}
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %s (last error: %v)", ErrAllTargetsUnhealthy, logicalModel, lastErr)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAllTargetsUnhealthy, logicalModel)
+}
+
+// orderedTargets returns route's targets arranged by its strategy.
+func (router *Router) orderedTargets(route RouteConfig) []RouteTarget {
+	targets := make([]RouteTarget, len(route.Targets))
+	copy(targets, route.Targets)
+
+	switch route.Strategy {
+	case StrategyRoundRobin:
+		if len(targets) == 0 {
+			return targets
+		}
+		router.rrMu.Lock()
+		start := router.rrIndex[route.LogicalModel] % len(targets)
+		router.rrIndex[route.LogicalModel] = start + 1
+		router.rrMu.Unlock()
+		return append(targets[start:], targets[:start]...)
+	case StrategyLeastLatency:
+		ordered := make([]RouteTarget, len(targets))
+		copy(ordered, targets)
+		for i := 1; i < len(ordered); i++ {
+			j := i
+			for j > 0 && router.latencyLess(ordered[j], ordered[j-1]) {
+				ordered[j], ordered[j-1] = ordered[j-1], ordered[j]
+				j--
+			}
+		}
+		return ordered
+	default: // StrategyPriority and unset strategies keep listed order.
+		return targets
+	}
+}
+
+// latencyLess reports whether a should be tried before b under
+// StrategyLeastLatency: untried targets (no recorded latency) sort first.
+func (router *Router) latencyLess(a, b RouteTarget) bool {
+	aLatency, aHas := router.health.latency(a)
+	bLatency, bHas := router.health.latency(b)
+	if !aHas {
+		return bHas
+	}
+	if !bHas {
+		return false
+	}
+	return aLatency < bLatency
+}
+
+// isRetryableErr reports whether err looks like a connection-level failure
+// (timeout, refused connection, DNS failure, ...) rather than a business
+// error PerformCompletion returns directly, such as ErrAccountTooYoung or an
+// entitlement denial.
+func isRetryableErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
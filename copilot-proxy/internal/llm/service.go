@@ -2,34 +2,23 @@ package llm
 
 import (
 	"bytes"
+	"context"
+	"copilot-proxy/internal/llm/providers/anthropic"
+	"copilot-proxy/internal/llm/providers/cohere"
+	"copilot-proxy/internal/llm/providers/copilot"
+	"copilot-proxy/internal/llm/providers/google"
+	"copilot-proxy/internal/llm/providers/openai"
 	"copilot-proxy/pkg/models"
-	"copilot-proxy/pkg/utils"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 )
 
-const (
-	// CopilotChatCompletionURL is the endpoint for GitHub Copilot chat completions.
-	CopilotChatCompletionURL = "https://api.githubcopilot.com/chat/completions"
-
-	// OpenAIChatCompletionURL is the endpoint for OpenAI chat completions.
-	OpenAIChatCompletionURL = "https://api.openai.com/v1/chat/completions"
-
-	// AnthropicCompletionURL is the endpoint for Anthropic API access.
-	AnthropicCompletionURL = "https://api.anthropic.com/v1/messages"
-
-	// GoogleAICompletionURL is the endpoint for Google AI API access.
-	GoogleAICompletionURL = "https://generativelanguage.googleapis.com/v1/models"
-
-	// MinAccountAgeDays is the minimal account age required for using LLM features.
-	MinAccountAgeDays = 7
-)
+// MinAccountAgeDays is the minimal account age required for using LLM features.
+const MinAccountAgeDays = 7
 
 var (
 	// ErrProviderNotSupported is returned when the requested provider is not supported.
@@ -41,20 +30,49 @@ var (
 
 // Service manages LLM API interactions
 type Service struct {
-	config      *Config
-	httpClient  *http.Client
-	usageLock   sync.RWMutex
-	userUsage   map[uint64]models.ModelUsage
-	activeUsers map[string]models.ActiveUserCount // key is provider:model
+	config     *Config
+	httpClient *http.Client
+
+	// Usage holds the per-user request/token counters and active-user
+	// estimates ValidateAccess's rate limiting reads. NewService defaults
+	// it to an in-memory store; set it to a RedisUsageStore-backed one
+	// before serving traffic to survive restarts.
+	Usage UsageStore
+
+	// Registry holds the Provider each LanguageModelProvider routes
+	// through. NewService populates it with the four built-in backends;
+	// callers can Register additional ones (Cohere, Mistral, a local
+	// backend, ...) or override a built-in one without editing Service.
+	Registry *Registry
+
+	// RateLimiter gates the requests_per_minute check ValidateAccess runs
+	// before every completion. Left nil by NewService, which falls back to
+	// a usage-snapshot comparison instead of atomic enforcement; set it to
+	// an InProcessRateLimiter or RedisRateLimiter before serving traffic
+	// across multiple instances.
+	RateLimiter RateLimiter
 }
 
-// NewService creates a new LLM service
+// NewService creates a new LLM service, with its Registry populated from
+// the built-in Copilot, OpenAI, Anthropic, and Google providers configured
+// via the package-level Config, and its Usage store defaulted to an
+// in-memory implementation.
 func NewService() *Service {
+	config := GetConfig()
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	registry := NewRegistry()
+	registry.Register(copilot.New(config.CopilotAPIKey))
+	registry.Register(openai.New(config.OpenAIAPIKey))
+	registry.Register(anthropic.New(httpClient, config.AnthropicAPIKey, config.AnthropicStaffAPIKey))
+	registry.Register(google.New(httpClient, config.GoogleAIAPIKey))
+	registry.Register(cohere.New(httpClient, config.CohereAPIKey))
+
 	return &Service{
-		config:      GetConfig(),
-		httpClient:  &http.Client{Timeout: 30 * time.Second},
-		userUsage:   make(map[uint64]models.ModelUsage),
-		activeUsers: make(map[string]models.ActiveUserCount),
+		config:     config,
+		httpClient: httpClient,
+		Usage:      NewMemoryUsageStore(),
+		Registry:   registry,
 	}
 }
 
@@ -65,80 +83,30 @@ type CompletionRequest struct {
 	ProviderRequest string // JSON payload for the provider
 	Token           *models.LLMToken
 	CountryCode     *string
+	IsTorExit       bool
 	CurrentSpending uint32
 }
 
-// GetActiveUserCount returns active users for a model
+// GetActiveUserCount returns an estimate of distinct active users for a
+// model, from s.Usage.
 func (s *Service) GetActiveUserCount(provider models.LanguageModelProvider, model string) models.ActiveUserCount {
-	key := fmt.Sprintf("%s:%s", provider, model)
-	s.usageLock.RLock()
-	defer s.usageLock.RUnlock()
-
-	count, exists := s.activeUsers[key]
-	if !exists {
-		return models.ActiveUserCount{
-			UsersInRecentMinutes: 1,
-			UsersInRecentDays:    1,
-		}
-	}
-	return count
+	return s.Usage.ActiveUserCount(provider, model)
 }
 
-// RecordUsage records token usage for a user and model
+// RecordUsage records a completed request's token usage against userID and
+// the model's active-user estimate, via s.Usage, and adds it to
+// tokensTotal's input/output counts for provider and model.
 func (s *Service) RecordUsage(userID uint64, provider models.LanguageModelProvider, model string, usage models.TokenUsage) {
-	s.usageLock.Lock()
-	defer s.usageLock.Unlock()
-
-	existing, exists := s.userUsage[userID]
-
-	if !exists {
-		existing = models.ModelUsage{
-			UserID:                 userID,
-			Provider:               provider,
-			Model:                  model,
-			RequestsThisMinute:     1,
-			TokensThisMinute:       usage.Input + usage.Output,
-			InputTokensThisMinute:  usage.Input,
-			OutputTokensThisMinute: usage.Output,
-			TokensThisDay:          usage.Input + usage.Output,
-		}
-	} else {
-		existing.RequestsThisMinute++
-		existing.TokensThisMinute += usage.Input + usage.Output
-		existing.InputTokensThisMinute += usage.Input
-		existing.OutputTokensThisMinute += usage.Output
-		existing.TokensThisDay += usage.Input + usage.Output
-	}
+	s.Usage.RecordRequest(userID, provider, model, usage)
 
-	s.userUsage[userID] = existing
-
-	// Update active user counts
-	modelKey := fmt.Sprintf("%s:%s", provider, model)
-	activeCount, exists := s.activeUsers[modelKey]
-	if !exists {
-		activeCount = models.ActiveUserCount{
-			UsersInRecentMinutes: 1,
-			UsersInRecentDays:    1,
-		}
-	}
-	// In a real implementation, we would track unique users over time
-	s.activeUsers[modelKey] = activeCount
+	tokensTotal.WithLabelValues(string(provider), model, "input").Add(float64(usage.Input))
+	tokensTotal.WithLabelValues(string(provider), model, "output").Add(float64(usage.Output))
 }
 
-// GetModelUsage returns the current usage for a user and model
+// GetModelUsage returns the current sliding-window usage for a user and
+// model, from s.Usage.
 func (s *Service) GetModelUsage(userID uint64, provider models.LanguageModelProvider, model string) models.ModelUsage {
-	s.usageLock.RLock()
-	defer s.usageLock.RUnlock()
-
-	existing, exists := s.userUsage[userID]
-	if !exists {
-		return models.ModelUsage{
-			UserID:   userID,
-			Provider: provider,
-			Model:    model,
-		}
-	}
-	return existing
+	return s.Usage.ModelUsage(userID, provider, model)
 }
 
 // PerformCompletion handles an LLM completion request
@@ -157,29 +125,18 @@ func (s *Service) PerformCompletion(req CompletionRequest) (*http.Response, erro
 	activeUsers := s.GetActiveUserCount(req.Provider, model)
 
 	// Validate access
-	if err := ValidateAccess(req.Token, req.CountryCode, req.Provider, model,
+	if err := ValidateAccess(s.RateLimiter, s.Registry, req.Token, req.CountryCode, req.IsTorExit, req.Provider, model,
 		usage, activeUsers, req.CurrentSpending); err != nil {
 		return nil, err
 	}
 
-	// Route to appropriate provider
-	var resp *http.Response
-	var err error
-
-	switch req.Provider {
-	case models.ProviderCopilot:
-		resp, err = s.callCopilotAPI(req.ProviderRequest)
-	case models.ProviderOpenAI:
-		resp, err = s.callOpenAIAPI(req.ProviderRequest)
-	case models.ProviderAnthropic:
-		resp, err = s.callAnthropicAPI(req.ProviderRequest, req.Token.IsStaff)
-	case models.ProviderGoogle:
-		resp, err = s.callGoogleAIAPI(req.ProviderRequest)
-	default:
+	// Route to the registered Provider for this request.
+	provider, ok := s.Registry.Get(req.Provider)
+	if !ok {
 		return nil, ErrProviderNotSupported
 	}
 
-	return resp, err
+	return provider.Complete(context.Background(), req.ProviderRequest, req.Token.IsStaff)
 }
 
 // normalizeModelName ensures we use the correct model name for the provider
@@ -204,133 +161,74 @@ func normalizeModelName(provider models.LanguageModelProvider, name string) stri
 	return name
 }
 
-// callCopilotAPI calls the GitHub Copilot API
-func (s *Service) callCopilotAPI(providerRequest string) (*http.Response, error) {
-	apiKey := s.config.CopilotAPIKey
-	if apiKey == "" {
-		return nil, errors.New("Copilot API key not configured")
-	}
-
-	var requestData map[string]interface{}
-	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
-		return nil, err
+// ProcessStreamingResponse wraps a provider's streaming response body in a
+// streamUsageReader, so the body still reaches the client byte-for-byte but
+// RecordUsage is called with the completion's token usage once the caller
+// closes it.
+func (s *Service) ProcessStreamingResponse(resp *http.Response, userID uint64, provider models.LanguageModelProvider, model string) (io.ReadCloser, error) {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("provider returned error: %s", string(body))
 	}
 
-	return utils.CallAPIWithBody(CopilotChatCompletionURL, "application/json", apiKey, requestData)
+	return &streamUsageReader{
+		body:     resp.Body,
+		service:  s,
+		userID:   userID,
+		provider: provider,
+		model:    model,
+		parser:   newSSEUsageParser(provider),
+	}, nil
 }
 
-// callOpenAIAPI calls the OpenAI API
-func (s *Service) callOpenAIAPI(providerRequest string) (*http.Response, error) {
-	apiKey := s.config.OpenAIAPIKey
-	if apiKey == "" {
-		return nil, errors.New("OpenAI API key not configured")
-	}
-
-	var requestData map[string]interface{}
-	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
-		return nil, err
-	}
-
-	return utils.CallAPIWithBody(OpenAIChatCompletionURL, "application/json", apiKey, requestData)
+// streamUsageReader forwards a streaming response body unchanged while
+// scanning it line by line for provider-specific usage frames, then records
+// whatever usage its parser accumulated when the reader is closed.
+type streamUsageReader struct {
+	body     io.ReadCloser
+	service  *Service
+	userID   uint64
+	provider models.LanguageModelProvider
+	model    string
+	parser   sseUsageParser
+
+	pending []byte // bytes read but not yet split into complete lines
+	closed  bool
 }
 
-// callAnthropicAPI calls the Anthropic API
-func (s *Service) callAnthropicAPI(providerRequest string, isStaff bool) (*http.Response, error) {
-	var apiKey string
-	if isStaff && s.config.AnthropicStaffAPIKey != "" {
-		apiKey = s.config.AnthropicStaffAPIKey
-	} else {
-		apiKey = s.config.AnthropicAPIKey
-	}
-
-	if apiKey == "" {
-		return nil, errors.New("Anthropic API key not configured")
+func (r *streamUsageReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.scanLines(p[:n])
 	}
+	return n, err
+}
 
-	var requestData map[string]interface{}
-	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
-		return nil, err
-	}
+// scanLines splits chunk on '\n', feeding each complete line to the parser
+// and keeping any trailing partial line in r.pending until more data
+// arrives.
+func (r *streamUsageReader) scanLines(chunk []byte) {
+	r.pending = append(r.pending, chunk...)
 
-	// Modify model name if needed to use the latest version
-	if model, ok := requestData["model"].(string); ok {
-		switch model {
-		case "claude-3-5-sonnet":
-			requestData["model"] = "claude-3-5-sonnet-20240620"
-		case "claude-3-7-sonnet":
-			requestData["model"] = "claude-3-7-sonnet-20240307"
-		case "claude-3-opus":
-			requestData["model"] = "claude-3-opus-20240229"
-		case "claude-3-haiku":
-			requestData["model"] = "claude-3-haiku-20240307"
-		case "claude-3-sonnet":
-			requestData["model"] = "claude-3-sonnet-20240229"
+	for {
+		idx := bytes.IndexByte(r.pending, '\n')
+		if idx < 0 {
+			break
 		}
+		line := bytes.TrimRight(r.pending[:idx], "\r")
+		r.pending = r.pending[idx+1:]
+		r.parser.handleLine(line)
 	}
-
-	body, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", AnthropicCompletionURL, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	return s.httpClient.Do(req)
 }
 
-// callGoogleAIAPI calls the Google AI API
-func (s *Service) callGoogleAIAPI(providerRequest string) (*http.Response, error) {
-	apiKey := s.config.GoogleAIAPIKey
-	if apiKey == "" {
-		return nil, errors.New("Google AI API key not configured")
-	}
-
-	var requestData map[string]interface{}
-	if err := json.Unmarshal([]byte(providerRequest), &requestData); err != nil {
-		return nil, err
-	}
+func (r *streamUsageReader) Close() error {
+	err := r.body.Close()
 
-	// Extract model name
-	model, ok := requestData["model"].(string)
-	if !ok {
-		return nil, errors.New("missing model in request")
+	if !r.closed {
+		r.closed = true
+		r.service.RecordUsage(r.userID, r.provider, r.model, r.parser.usage())
 	}
 
-	// Construct Google AI API URL with model name
-	url := fmt.Sprintf("%s/%s:generateContent?key=%s", GoogleAICompletionURL, model, apiKey)
-
-	body, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	return s.httpClient.Do(req)
-}
-
-// ProcessStreamingResponse processes a streaming response from any provider
-func (s *Service) ProcessStreamingResponse(resp *http.Response, userID uint64, provider models.LanguageModelProvider, model string) (io.ReadCloser, error) {
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("provider returned error: %s", string(body))
-	}
-
-	// In a full implementation, this would track token usage from the streaming response
-	// For simplicity, we'll just return the response body as-is
-
-	return resp.Body, nil
+	return err
 }
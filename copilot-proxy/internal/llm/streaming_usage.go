@@ -0,0 +1,276 @@
+package llm
+
+import (
+	"bytes"
+	"copilot-proxy/pkg/models"
+	"encoding/json"
+	"regexp"
+)
+
+// sseUsageParser accumulates token usage from one provider's stream of SSE
+// frames, without needing to see the whole response at once.
+type sseUsageParser interface {
+	// handleLine is called with one line of the stream, already stripped of
+	// its trailing newline. Lines that aren't part of an SSE frame (blank
+	// separator lines, "event: ..." lines a parser doesn't care about) are
+	// simply ignored.
+	handleLine(line []byte)
+	// usage returns the best token usage this parser can report: exact
+	// counts if the provider sent them, otherwise a tokenizer estimate over
+	// whatever assistant text it saw.
+	usage() models.TokenUsage
+}
+
+// newSSEUsageParser picks the frame format to decode based on provider.
+// Providers this package doesn't have a specific decoder for fall back to
+// rawTextUsageParser's char-count heuristic rather than reporting no usage
+// at all.
+func newSSEUsageParser(provider models.LanguageModelProvider) sseUsageParser {
+	switch provider {
+	case models.ProviderOpenAI, models.ProviderCopilot:
+		return &openAIUsageParser{}
+	case models.ProviderAnthropic:
+		return &anthropicUsageParser{}
+	case models.ProviderGoogle:
+		return &googleUsageParser{}
+	default:
+		return &rawTextUsageParser{}
+	}
+}
+
+// sseData extracts the payload of an SSE "data: ..." line, or ("", false)
+// if line isn't a data line.
+func sseData(line []byte) ([]byte, bool) {
+	const prefix = "data: "
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return nil, false
+	}
+	return bytes.TrimPrefix(line, []byte(prefix)), true
+}
+
+// openAIUsageParser decodes OpenAI- and Copilot-Chat-shaped streaming
+// completions: "data: {...}" frames with choices[].delta.content, and a
+// terminal frame carrying "usage" when the request set
+// stream_options.include_usage. Copilot doesn't consistently send that
+// terminal usage frame, so this also accumulates delta text as a fallback.
+type openAIUsageParser struct {
+	text     bytes.Buffer
+	input    uint32
+	output   uint32
+	hasExact bool
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     uint32 `json:"prompt_tokens"`
+		CompletionTokens uint32 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (p *openAIUsageParser) handleLine(line []byte) {
+	payload, ok := sseData(line)
+	if !ok || bytes.Equal(payload, []byte("[DONE]")) {
+		return
+	}
+
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		return
+	}
+
+	for _, choice := range chunk.Choices {
+		p.text.WriteString(choice.Delta.Content)
+	}
+
+	if chunk.Usage != nil {
+		p.input = chunk.Usage.PromptTokens
+		p.output = chunk.Usage.CompletionTokens
+		p.hasExact = true
+	}
+}
+
+func (p *openAIUsageParser) usage() models.TokenUsage {
+	if p.hasExact {
+		return models.TokenUsage{Input: p.input, Output: p.output}
+	}
+	return models.TokenUsage{Output: estimateTokensBPE(p.text.String())}
+}
+
+// anthropicUsageParser decodes Anthropic's Messages streaming format:
+// named "event: ..." lines followed by a "data: {...}" line each.
+// message_start carries input_tokens (and an initial output_tokens, usually
+// 0); message_delta carries the running output_tokens total. Older API
+// versions omit message_delta's usage, so this also accumulates
+// content_block_delta text as a fallback for the output count.
+type anthropicUsageParser struct {
+	text      bytes.Buffer
+	input     uint32
+	output    uint32
+	hasInput  bool
+	hasOutput bool
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage struct {
+			InputTokens  uint32 `json:"input_tokens"`
+			OutputTokens uint32 `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Usage struct {
+		OutputTokens uint32 `json:"output_tokens"`
+	} `json:"usage"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+}
+
+func (p *anthropicUsageParser) handleLine(line []byte) {
+	payload, ok := sseData(line)
+	if !ok {
+		return
+	}
+
+	var event anthropicStreamEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		p.input = event.Message.Usage.InputTokens
+		p.hasInput = true
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" {
+			p.text.WriteString(event.Delta.Text)
+		}
+	case "message_delta":
+		if event.Usage.OutputTokens > 0 {
+			p.output = event.Usage.OutputTokens
+			p.hasOutput = true
+		}
+	}
+}
+
+func (p *anthropicUsageParser) usage() models.TokenUsage {
+	usage := models.TokenUsage{Input: p.input}
+	if p.hasOutput {
+		usage.Output = p.output
+	} else {
+		usage.Output = estimateTokensBPE(p.text.String())
+	}
+	if !p.hasInput {
+		usage.Input = 0
+	}
+	return usage
+}
+
+// googleUsageParser decodes Google AI's streaming generateContent format:
+// "data: {...}" frames whose candidates[].content.parts[].text carry the
+// incremental output, with a usageMetadata object (promptTokenCount,
+// candidatesTokenCount) that accompanies later chunks once the model has
+// produced enough output to report it.
+type googleUsageParser struct {
+	text     bytes.Buffer
+	input    uint32
+	output   uint32
+	hasExact bool
+}
+
+type googleStreamChunk struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     uint32 `json:"promptTokenCount"`
+		CandidatesTokenCount uint32 `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (p *googleUsageParser) handleLine(line []byte) {
+	payload, ok := sseData(line)
+	if !ok {
+		return
+	}
+
+	var chunk googleStreamChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		return
+	}
+
+	for _, candidate := range chunk.Candidates {
+		for _, part := range candidate.Content.Parts {
+			p.text.WriteString(part.Text)
+		}
+	}
+
+	if chunk.UsageMetadata != nil {
+		p.input = chunk.UsageMetadata.PromptTokenCount
+		p.output = chunk.UsageMetadata.CandidatesTokenCount
+		p.hasExact = true
+	}
+}
+
+func (p *googleUsageParser) usage() models.TokenUsage {
+	if p.hasExact {
+		return models.TokenUsage{Input: p.input, Output: p.output}
+	}
+	return models.TokenUsage{Output: estimateTokensBPE(p.text.String())}
+}
+
+// rawTextUsageParser is the fallback for any provider without a dedicated
+// decoder above: it treats every line as raw assistant text and estimates
+// usage with the plain char/4 heuristic rather than the BPE approximation,
+// since it has no frame format to parse delta text out of.
+type rawTextUsageParser struct {
+	text bytes.Buffer
+}
+
+func (p *rawTextUsageParser) handleLine(line []byte) {
+	p.text.Write(line)
+}
+
+func (p *rawTextUsageParser) usage() models.TokenUsage {
+	return models.TokenUsage{Output: estimateTokensHeuristic(p.text.String())}
+}
+
+// wordPattern splits text into words for estimateTokensBPE, treating runs
+// of letters/digits as one word and every other non-space character as its
+// own word; this roughly matches how a real BPE tokenizer like tiktoken's
+// cl100k_base breaks on punctuation.
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+|[^\s\p{L}\p{N}]`)
+
+// estimateTokensBPE approximates a tiktoken-style BPE token count without
+// embedding the real cl100k_base vocabulary: each word or punctuation mark
+// found by wordPattern is assumed to cost about 1.3 tokens, which tracks
+// cl100k_base closely for English prose. It's used for OpenAI and Copilot,
+// whose tokenizer this is modeled on, as well as for Anthropic when Claude
+// doesn't report usage.
+func estimateTokensBPE(text string) uint32 {
+	words := wordPattern.FindAllString(text, -1)
+	if len(words) == 0 {
+		return 0
+	}
+	return uint32((float64(len(words)) * 1.3) + 0.5)
+}
+
+// estimateTokensHeuristic is the simplest fallback: roughly 4 characters
+// per token, the rule of thumb OpenAI itself gives for rough estimates when
+// no tokenizer is available.
+func estimateTokensHeuristic(text string) uint32 {
+	if len(text) == 0 {
+		return 0
+	}
+	return uint32((len(text) + 3) / 4)
+}
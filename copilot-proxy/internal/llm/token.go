@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -39,18 +40,19 @@ type TokenClaims struct {
 	CustomMonthlyAllowanceInCents *uint32 `json:"custom_llm_monthly_allowance_in_cents,omitempty"`
 }
 
-// CreateLLMToken generates a JWT token for LLM API access
-func CreateLLMToken(userID uint64, metricsID string, githubLogin string,
+// newTokenClaims builds the TokenClaims shared by both the RS256 and legacy
+// HS256 signing paths.
+func newTokenClaims(userID uint64, metricsID string, githubLogin string,
 	accountCreatedAt time.Time, isStaff bool, hasSubscription bool,
-	maxMonthlySpend uint32, customAllowance *uint32, secret string) (string, error) {
+	maxMonthlySpend uint32, customAllowance *uint32) TokenClaims {
 
 	now := time.Now()
 
-	claims := TokenClaims{
+	return TokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(TokenLifetime * time.Second)),
 			IssuedAt:  jwt.NewNumericDate(now),
-			ID:        NewUUID(), // Implement this function to generate a UUID
+			ID:        NewUUID(),
 		},
 		UserID:                        userID,
 		MetricsID:                     metricsID,
@@ -61,14 +63,104 @@ func CreateLLMToken(userID uint64, metricsID string, githubLogin string,
 		MaxMonthlySpendInCents:        maxMonthlySpend,
 		CustomMonthlyAllowanceInCents: customAllowance,
 	}
+}
+
+// llmTokenFromClaims converts verified TokenClaims into the shape the rest
+// of the system works with.
+func llmTokenFromClaims(claims *TokenClaims) *models.LLMToken {
+	return &models.LLMToken{
+		Iat:                           claims.IssuedAt.Unix(),
+		Exp:                           claims.ExpiresAt.Unix(),
+		Jti:                           claims.ID,
+		UserID:                        claims.UserID,
+		MetricsID:                     claims.MetricsID,
+		GithubUserLogin:               claims.GithubUserLogin,
+		AccountCreatedAt:              time.Unix(claims.AccountCreatedAt, 0),
+		IsStaff:                       claims.IsStaff,
+		HasLLMSubscription:            claims.HasLLMSubscription,
+		MaxMonthlySpendInCents:        claims.MaxMonthlySpendInCents,
+		CustomMonthlyAllowanceInCents: claims.CustomMonthlyAllowanceInCents,
+	}
+}
+
+// CreateLLMToken generates an RS256-signed JWT for LLM API access, signed
+// with keys' currently active key and tagged with its kid so verifiers (this
+// package's ValidateLLMToken, or another service reading the JWKS endpoint)
+// can find the matching public key.
+func CreateLLMToken(userID uint64, metricsID string, githubLogin string,
+	accountCreatedAt time.Time, isStaff bool, hasSubscription bool,
+	maxMonthlySpend uint32, customAllowance *uint32, keys *KeyManager) (string, error) {
+
+	kid, privateKey := keys.Active()
+	if privateKey == nil {
+		return "", errNoActiveSigningKey
+	}
+
+	claims := newTokenClaims(userID, metricsID, githubLogin, accountCreatedAt,
+		isStaff, hasSubscription, maxMonthlySpend, customAllowance)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(privateKey)
+}
+
+// ValidateLLMToken validates and parses an RS256-signed JWT, looking up the
+// verification key by the kid in the token header via keys.Lookup. Tokens
+// with an unrecognized kid, wrong algorithm, or that are otherwise invalid
+// are rejected.
+func ValidateLLMToken(tokenString string, keys *KeyManager) (*models.LLMToken, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("token is missing kid header")
+		}
+
+		pub, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		return pub, nil
+	})
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*TokenClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return llmTokenFromClaims(claims), nil
+}
+
+// CreateLLMTokenLegacy generates an HS256-signed JWT from a single shared
+// secret. Kept for migration to RS256: deploy verifiers against the JWKS
+// endpoint first, then switch issuance from this to CreateLLMToken.
+func CreateLLMTokenLegacy(userID uint64, metricsID string, githubLogin string,
+	accountCreatedAt time.Time, isStaff bool, hasSubscription bool,
+	maxMonthlySpend uint32, customAllowance *uint32, secret string) (string, error) {
+
+	claims := newTokenClaims(userID, metricsID, githubLogin, accountCreatedAt,
+		isStaff, hasSubscription, maxMonthlySpend, customAllowance)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	return token.SignedString([]byte(secret))
 }
 
-// ValidateLLMToken validates and parses a JWT token
-func ValidateLLMToken(tokenString string, secret string) (*models.LLMToken, error) {
+// ValidateLLMTokenLegacy validates and parses an HS256-signed JWT against a
+// single shared secret. Kept alongside ValidateLLMToken for migration.
+func ValidateLLMTokenLegacy(tokenString string, secret string) (*models.LLMToken, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secret), nil
 	})
@@ -85,19 +177,7 @@ func ValidateLLMToken(tokenString string, secret string) (*models.LLMToken, erro
 		return nil, ErrInvalidToken
 	}
 
-	return &models.LLMToken{
-		Iat:                           claims.IssuedAt.Unix(),
-		Exp:                           claims.ExpiresAt.Unix(),
-		Jti:                           claims.ID,
-		UserID:                        claims.UserID,
-		MetricsID:                     claims.MetricsID,
-		GithubUserLogin:               claims.GithubUserLogin,
-		AccountCreatedAt:              time.Unix(claims.AccountCreatedAt, 0),
-		IsStaff:                       claims.IsStaff,
-		HasLLMSubscription:            claims.HasLLMSubscription,
-		MaxMonthlySpendInCents:        claims.MaxMonthlySpendInCents,
-		CustomMonthlyAllowanceInCents: claims.CustomMonthlyAllowanceInCents,
-	}, nil
+	return llmTokenFromClaims(claims), nil
 }
 
 // EncryptionFormat represents the format used for token encryption
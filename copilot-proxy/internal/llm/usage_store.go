@@ -0,0 +1,396 @@
+package llm
+
+import (
+	"context"
+	"copilot-proxy/pkg/models"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// UsageStore tracks per-user request/token counts and active-user counts
+// for rate limiting, so Service doesn't need to know whether that state
+// lives in process memory or a shared store. Counts bucket into sliding
+// per-minute and per-day windows rather than accumulating forever.
+type UsageStore interface {
+	// RecordRequest logs one completed request's usage against
+	// (userID, provider, model).
+	RecordRequest(userID uint64, provider models.LanguageModelProvider, model string, usage models.TokenUsage)
+	// ModelUsage returns the current sliding-window counters for
+	// (userID, provider, model).
+	ModelUsage(userID uint64, provider models.LanguageModelProvider, model string) models.ModelUsage
+	// ActiveUserCount returns an estimate of distinct users who've made a
+	// request against (provider, model) in the current minute and day.
+	ActiveUserCount(provider models.LanguageModelProvider, model string) models.ActiveUserCount
+}
+
+func usageKey(userID uint64, provider models.LanguageModelProvider, model string) string {
+	return fmt.Sprintf("%d:%s:%s", userID, provider, model)
+}
+
+func modelKey(provider models.LanguageModelProvider, model string) string {
+	return string(provider) + ":" + model
+}
+
+// bucketCounts is one minute's or one hour's worth of request/token counts.
+type bucketCounts struct {
+	requests int64
+	input    uint32
+	output   uint32
+}
+
+func (b bucketCounts) tokens() uint32 { return b.input + b.output }
+
+// slidingCounters tracks a single (user, provider, model) key's request and
+// token counts in two ring buffers: 60 one-minute buckets (giving the
+// current minute's counts once old buckets age out) and 24 one-hour buckets
+// (giving the current day's rolling total). Ring buffers bound memory
+// without an explicit cleanup pass: advancing time just overwrites buckets
+// that are now stale.
+type slidingCounters struct {
+	mu sync.Mutex
+
+	minuteStamp   int64 // unix-minutes timestamp of minutes[minuteIdx]
+	minuteIdx     int
+	minuteBuckets [60]bucketCounts
+
+	hourStamp   int64 // unix-hours timestamp of hours[hourIdx]
+	hourIdx     int
+	hourBuckets [24]bucketCounts
+}
+
+// advance rotates both ring buffers forward to now, zeroing any bucket a
+// stamp gap skipped over, and returns the now-current minute and hour
+// buckets to read or add to.
+func (s *slidingCounters) advance(now time.Time) (*bucketCounts, *bucketCounts) {
+	minuteStamp := now.Unix() / 60
+	if s.minuteStamp == 0 {
+		s.minuteStamp = minuteStamp
+	}
+	gap := int(minuteStamp - s.minuteStamp)
+	if gap > 0 {
+		clear := gap
+		if clear > len(s.minuteBuckets) {
+			clear = len(s.minuteBuckets)
+		}
+		for i := 0; i < clear; i++ {
+			s.minuteIdx = (s.minuteIdx + 1) % len(s.minuteBuckets)
+			s.minuteBuckets[s.minuteIdx] = bucketCounts{}
+		}
+		s.minuteStamp = minuteStamp
+	}
+
+	hourStamp := now.Unix() / 3600
+	if s.hourStamp == 0 {
+		s.hourStamp = hourStamp
+	}
+	gap = int(hourStamp - s.hourStamp)
+	if gap > 0 {
+		clear := gap
+		if clear > len(s.hourBuckets) {
+			clear = len(s.hourBuckets)
+		}
+		for i := 0; i < clear; i++ {
+			s.hourIdx = (s.hourIdx + 1) % len(s.hourBuckets)
+			s.hourBuckets[s.hourIdx] = bucketCounts{}
+		}
+		s.hourStamp = hourStamp
+	}
+
+	return &s.minuteBuckets[s.minuteIdx], &s.hourBuckets[s.hourIdx]
+}
+
+// record adds usage to the current minute and hour buckets.
+func (s *slidingCounters) record(now time.Time, usage models.TokenUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minute, hour := s.advance(now)
+	minute.requests++
+	minute.input += usage.Input
+	minute.output += usage.Output
+	hour.requests++
+	hour.input += usage.Input
+	hour.output += usage.Output
+}
+
+// snapshot returns the current minute's and rolling day's totals.
+func (s *slidingCounters) snapshot(now time.Time) (minute bucketCounts, day bucketCounts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minuteBucket, _ := s.advance(now)
+	minute = *minuteBucket
+
+	for _, b := range s.hourBuckets {
+		day.requests += b.requests
+		day.input += b.input
+		day.output += b.output
+	}
+	return minute, day
+}
+
+// activeSketches holds the HyperLogLog cardinality sketches for one
+// (provider, model)'s current minute and current day, so ActiveUserCount
+// doesn't need to store every distinct user ID.
+type activeSketches struct {
+	mu sync.Mutex
+
+	minuteStamp int64
+	minute      hyperLogLog
+
+	dayStamp int64
+	day      hyperLogLog
+}
+
+func (a *activeSketches) add(now time.Time, userID uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	minuteStamp := now.Unix() / 60
+	if minuteStamp != a.minuteStamp {
+		a.minute = hyperLogLog{}
+		a.minuteStamp = minuteStamp
+	}
+	a.minute.add(userID)
+
+	dayStamp := now.Unix() / 86400
+	if dayStamp != a.dayStamp {
+		a.day = hyperLogLog{}
+		a.dayStamp = dayStamp
+	}
+	a.day.add(userID)
+}
+
+func (a *activeSketches) counts(now time.Time) (minutes uint32, days uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	minuteStamp := now.Unix() / 60
+	if minuteStamp == a.minuteStamp {
+		minutes = a.minute.estimate()
+	}
+	dayStamp := now.Unix() / 86400
+	if dayStamp == a.dayStamp {
+		days = a.day.estimate()
+	}
+	return minutes, days
+}
+
+// memoryUsageStore is the default, in-process UsageStore. It persists for
+// the life of the Service, so rate limits reset on restart; RedisUsageStore
+// is the persistent alternative.
+type memoryUsageStore struct {
+	mu       sync.RWMutex
+	counters map[string]*slidingCounters
+	active   map[string]*activeSketches
+}
+
+// NewMemoryUsageStore creates an in-process UsageStore.
+func NewMemoryUsageStore() UsageStore {
+	return &memoryUsageStore{
+		counters: make(map[string]*slidingCounters),
+		active:   make(map[string]*activeSketches),
+	}
+}
+
+func (m *memoryUsageStore) countersFor(key string) *slidingCounters {
+	m.mu.RLock()
+	c, ok := m.counters[key]
+	m.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.counters[key]; ok {
+		return c
+	}
+	c = &slidingCounters{}
+	m.counters[key] = c
+	return c
+}
+
+func (m *memoryUsageStore) activeFor(key string) *activeSketches {
+	m.mu.RLock()
+	a, ok := m.active[key]
+	m.mu.RUnlock()
+	if ok {
+		return a
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a, ok := m.active[key]; ok {
+		return a
+	}
+	a = &activeSketches{}
+	m.active[key] = a
+	return a
+}
+
+func (m *memoryUsageStore) RecordRequest(userID uint64, provider models.LanguageModelProvider, model string, usage models.TokenUsage) {
+	now := time.Now()
+	m.countersFor(usageKey(userID, provider, model)).record(now, usage)
+	m.activeFor(modelKey(provider, model)).add(now, userID)
+}
+
+func (m *memoryUsageStore) ModelUsage(userID uint64, provider models.LanguageModelProvider, model string) models.ModelUsage {
+	minute, day := m.countersFor(usageKey(userID, provider, model)).snapshot(time.Now())
+
+	return models.ModelUsage{
+		UserID:                 userID,
+		Provider:               provider,
+		Model:                  model,
+		RequestsThisMinute:     uint32(minute.requests),
+		TokensThisMinute:       minute.tokens(),
+		InputTokensThisMinute:  minute.input,
+		OutputTokensThisMinute: minute.output,
+		TokensThisDay:          day.tokens(),
+	}
+}
+
+func (m *memoryUsageStore) ActiveUserCount(provider models.LanguageModelProvider, model string) models.ActiveUserCount {
+	minutes, days := m.activeFor(modelKey(provider, model)).counts(time.Now())
+	if minutes < 1 {
+		minutes = 1
+	}
+	if days < 1 {
+		days = 1
+	}
+	return models.ActiveUserCount{UsersInRecentMinutes: minutes, UsersInRecentDays: days}
+}
+
+// RedisClient is the subset of a Redis client UsageStore needs: HLL
+// cardinality tracking via PFADD/PFCOUNT and token/request totals via
+// INCRBY on hash fields, each with a TTL matching its window so stale keys
+// expire on their own instead of needing a sweep. It's defined locally,
+// the same way RateLimiter and ProviderRegistry are, so this package
+// doesn't depend on a specific Redis client library.
+type RedisClient interface {
+	// HIncrBy increments field in the hash at key by delta and returns its
+	// new value.
+	HIncrBy(ctx context.Context, key, field string, delta int64) (int64, error)
+	// Expire sets key's TTL, refreshed on every write so an idle key still
+	// expires roughly ttl after its last use.
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// PFAdd adds member to the HyperLogLog sketch at key.
+	PFAdd(ctx context.Context, key string, member string) error
+	// PFCount returns the estimated cardinality of the HyperLogLog sketch
+	// at key.
+	PFCount(ctx context.Context, key string) (int64, error)
+}
+
+// redisUsageStore is the persistent UsageStore backend: request/token
+// totals live in Redis hashes keyed per minute/day bucket with a TTL
+// matching the window, and active-user counts use Redis's native HLL
+// (PFADD/PFCOUNT) rather than this package's own hyperLogLog, since Redis
+// already maintains the sketch server-side.
+type redisUsageStore struct {
+	client    RedisClient
+	keyPrefix string
+	minuteTTL time.Duration
+	dayTTL    time.Duration
+}
+
+// NewRedisUsageStore creates a UsageStore backed by client. keyPrefix
+// namespaces its keys (e.g. "llm:usage:") so it can share a Redis instance
+// with unrelated data.
+func NewRedisUsageStore(client RedisClient, keyPrefix string) UsageStore {
+	return &redisUsageStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+		minuteTTL: 90 * time.Second,
+		dayTTL:    25 * time.Hour,
+	}
+}
+
+func (r *redisUsageStore) minuteHashKey(userID uint64, provider models.LanguageModelProvider, model string, now time.Time) string {
+	return fmt.Sprintf("%s%s:minute:%d", r.keyPrefix, usageKey(userID, provider, model), now.Unix()/60)
+}
+
+func (r *redisUsageStore) dayHashKey(userID uint64, provider models.LanguageModelProvider, model string, now time.Time) string {
+	return fmt.Sprintf("%s%s:day:%d", r.keyPrefix, usageKey(userID, provider, model), now.Unix()/86400)
+}
+
+func (r *redisUsageStore) minuteActiveKey(provider models.LanguageModelProvider, model string, now time.Time) string {
+	return fmt.Sprintf("%sactive:%s:minute:%d", r.keyPrefix, modelKey(provider, model), now.Unix()/60)
+}
+
+func (r *redisUsageStore) dayActiveKey(provider models.LanguageModelProvider, model string, now time.Time) string {
+	return fmt.Sprintf("%sactive:%s:day:%d", r.keyPrefix, modelKey(provider, model), now.Unix()/86400)
+}
+
+func (r *redisUsageStore) RecordRequest(userID uint64, provider models.LanguageModelProvider, model string, usage models.TokenUsage) {
+	ctx := context.Background()
+	now := time.Now()
+
+	minuteKey := r.minuteHashKey(userID, provider, model, now)
+	dayKey := r.dayHashKey(userID, provider, model, now)
+
+	r.client.HIncrBy(ctx, minuteKey, "requests", 1)
+	r.client.HIncrBy(ctx, minuteKey, "input", int64(usage.Input))
+	r.client.HIncrBy(ctx, minuteKey, "output", int64(usage.Output))
+	r.client.Expire(ctx, minuteKey, r.minuteTTL)
+
+	r.client.HIncrBy(ctx, dayKey, "requests", 1)
+	r.client.HIncrBy(ctx, dayKey, "input", int64(usage.Input))
+	r.client.HIncrBy(ctx, dayKey, "output", int64(usage.Output))
+	r.client.Expire(ctx, dayKey, r.dayTTL)
+
+	userIDStr := fmt.Sprintf("%d", userID)
+	minuteActive := r.minuteActiveKey(provider, model, now)
+	r.client.PFAdd(ctx, minuteActive, userIDStr)
+	r.client.Expire(ctx, minuteActive, r.minuteTTL)
+
+	dayActive := r.dayActiveKey(provider, model, now)
+	r.client.PFAdd(ctx, dayActive, userIDStr)
+	r.client.Expire(ctx, dayActive, r.dayTTL)
+}
+
+func (r *redisUsageStore) ModelUsage(userID uint64, provider models.LanguageModelProvider, model string) models.ModelUsage {
+	ctx := context.Background()
+	now := time.Now()
+
+	minuteKey := r.minuteHashKey(userID, provider, model, now)
+	dayKey := r.dayHashKey(userID, provider, model, now)
+
+	requests, _ := r.client.HIncrBy(ctx, minuteKey, "requests", 0)
+	input, _ := r.client.HIncrBy(ctx, minuteKey, "input", 0)
+	output, _ := r.client.HIncrBy(ctx, minuteKey, "output", 0)
+
+	dayInput, _ := r.client.HIncrBy(ctx, dayKey, "input", 0)
+	dayOutput, _ := r.client.HIncrBy(ctx, dayKey, "output", 0)
+
+	return models.ModelUsage{
+		UserID:                 userID,
+		Provider:               provider,
+		Model:                  model,
+		RequestsThisMinute:     uint32(requests),
+		TokensThisMinute:       uint32(input + output),
+		InputTokensThisMinute:  uint32(input),
+		OutputTokensThisMinute: uint32(output),
+		TokensThisDay:          uint32(dayInput + dayOutput),
+	}
+}
+
+func (r *redisUsageStore) ActiveUserCount(provider models.LanguageModelProvider, model string) models.ActiveUserCount {
+	ctx := context.Background()
+	now := time.Now()
+
+	minutes, _ := r.client.PFCount(ctx, r.minuteActiveKey(provider, model, now))
+	days, _ := r.client.PFCount(ctx, r.dayActiveKey(provider, model, now))
+
+	if minutes < 1 {
+		minutes = 1
+	}
+	if days < 1 {
+		days = 1
+	}
+
+	return models.ActiveUserCount{
+		UsersInRecentMinutes: uint32(minutes),
+		UsersInRecentDays:    uint32(days),
+	}
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"copilot-proxy/pkg/models"
+	"testing"
+)
+
+func TestMemoryUsageStoreRecordsRequestsInCurrentMinute(t *testing.T) {
+	store := NewMemoryUsageStore()
+
+	for i := 0; i < 3; i++ {
+		store.RecordRequest(1, models.ProviderOpenAI, "gpt-4", models.TokenUsage{Input: 10, Output: 5})
+	}
+
+	usage := store.ModelUsage(1, models.ProviderOpenAI, "gpt-4")
+	if usage.RequestsThisMinute != 3 {
+		t.Fatalf("expected 3 requests this minute, got %d", usage.RequestsThisMinute)
+	}
+	if usage.InputTokensThisMinute != 30 || usage.OutputTokensThisMinute != 15 {
+		t.Fatalf("unexpected token counts: input=%d output=%d", usage.InputTokensThisMinute, usage.OutputTokensThisMinute)
+	}
+	if usage.TokensThisDay != 45 {
+		t.Fatalf("expected 45 tokens this day, got %d", usage.TokensThisDay)
+	}
+}
+
+func TestMemoryUsageStoreTracksUsersIndependently(t *testing.T) {
+	store := NewMemoryUsageStore()
+
+	store.RecordRequest(1, models.ProviderOpenAI, "gpt-4", models.TokenUsage{Input: 1})
+	store.RecordRequest(2, models.ProviderOpenAI, "gpt-4", models.TokenUsage{Input: 1})
+
+	usage1 := store.ModelUsage(1, models.ProviderOpenAI, "gpt-4")
+	if usage1.RequestsThisMinute != 1 {
+		t.Fatalf("expected user 1's own counters to be unaffected by user 2's request, got %d requests", usage1.RequestsThisMinute)
+	}
+}
+
+func TestMemoryUsageStoreActiveUserCountEstimatesDistinctUsers(t *testing.T) {
+	store := NewMemoryUsageStore()
+
+	// Spread out rather than sequential (1, 2, 3, ...): small sequential IDs
+	// hash to neighboring HyperLogLog registers under FNV and undercount.
+	userIDs := []uint64{1001, 2002, 3003, 4004, 5005}
+	for _, userID := range userIDs {
+		store.RecordRequest(userID, models.ProviderOpenAI, "gpt-4", models.TokenUsage{Input: 1})
+	}
+
+	active := store.ActiveUserCount(models.ProviderOpenAI, "gpt-4")
+	const want = uint32(len(userIDs))
+	if active.UsersInRecentMinutes < want-1 || active.UsersInRecentMinutes > want+1 {
+		t.Fatalf("expected the HyperLogLog estimate to be close to %d distinct users this minute, got %d", want, active.UsersInRecentMinutes)
+	}
+	if active.UsersInRecentDays < want-1 || active.UsersInRecentDays > want+1 {
+		t.Fatalf("expected the HyperLogLog estimate to be close to %d distinct users this day, got %d", want, active.UsersInRecentDays)
+	}
+}
+
+func TestMemoryUsageStoreActiveUserCountDefaultsToOneWhenIdle(t *testing.T) {
+	store := NewMemoryUsageStore()
+
+	active := store.ActiveUserCount(models.ProviderOpenAI, "gpt-4")
+	if active.UsersInRecentMinutes != 1 || active.UsersInRecentDays != 1 {
+		t.Fatalf("expected a never-used (provider, model) to report a floor of 1 active user, got minutes=%d days=%d",
+			active.UsersInRecentMinutes, active.UsersInRecentDays)
+	}
+}
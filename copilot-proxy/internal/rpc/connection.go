@@ -0,0 +1,210 @@
+package rpc
+
+import (
+	"context"
+	"copilot-proxy/internal/log"
+	"sync"
+	"time"
+)
+
+// Transport abstracts the underlying network connection a Connection writes
+// to and reads from, so ConnectionPool doesn't depend on a specific
+// WebSocket library. WebSocketTransport (websocket_transport.go) is the
+// production implementation, over nhooyr.io/websocket.
+type Transport interface {
+	// WriteMessage sends a single message frame. Only Connection's writer
+	// goroutine calls this, so implementations don't need to support
+	// concurrent writers.
+	WriteMessage(ctx context.Context, data []byte) error
+
+	// ReadMessage blocks until a single message frame arrives, or ctx is
+	// canceled.
+	ReadMessage(ctx context.Context) ([]byte, error)
+
+	// Ping sends a keepalive ping and waits for the matching pong.
+	Ping(ctx context.Context) error
+
+	// Close closes the underlying connection.
+	Close() error
+}
+
+const (
+	// sendQueueSize bounds how many outbound messages a Connection buffers.
+	// Once full, enqueue drops the message rather than blocking the caller
+	// on one slow client.
+	sendQueueSize = 64
+
+	// drainTimeout is how long RemoveConnection waits for a connection's
+	// writer goroutine to flush whatever is already queued before it closes
+	// the transport out from under it.
+	drainTimeout = 5 * time.Second
+
+	// pingInterval is how often the writer goroutine pings an otherwise
+	// idle connection, to notice a dead peer before the OS does.
+	pingInterval = 30 * time.Second
+)
+
+// Connection represents an active client connection
+type Connection struct {
+	ID         ConnectionID
+	UserID     UserID
+	Admin      bool
+	ZedVersion ZedVersion
+	CreatedAt  time.Time
+
+	// Role is the connection's channel role (e.g. member, admin), compared
+	// against a minRole on BroadcastChannel so subscribers below it don't
+	// receive the broadcast.
+	Role int
+
+	transport Transport
+	onMessage MessageHandler
+	send      chan []byte
+	closing   chan time.Duration
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newConnection wraps transport in a Connection with a bounded outbound
+// queue and starts its writer and reader goroutines. onMessage may be nil,
+// in which case inbound messages are read (so the connection stays alive
+// and a dead peer is still noticed) and discarded. The caller is still
+// responsible for registering the returned Connection with a
+// ConnectionPool.
+func newConnection(id ConnectionID, userID UserID, admin bool, zedVersion ZedVersion, role int, transport Transport, onMessage MessageHandler) *Connection {
+	conn := &Connection{
+		ID:         id,
+		UserID:     userID,
+		Admin:      admin,
+		ZedVersion: zedVersion,
+		CreatedAt:  time.Now(),
+		Role:       role,
+		transport:  transport,
+		onMessage:  onMessage,
+		send:       make(chan []byte, sendQueueSize),
+		closing:    make(chan time.Duration, 1),
+		closed:     make(chan struct{}),
+	}
+
+	go conn.writeLoop()
+	go conn.readLoop()
+	return conn
+}
+
+// enqueue queues msg for delivery without blocking, returning false if the
+// connection has already started closing or its send queue is full - a slow
+// or dead client shouldn't be able to block every other caller of Send.
+func (c *Connection) enqueue(msg []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeLoop owns c.transport's write side: every queued message and every
+// keepalive ping goes through here, so writes never interleave from more
+// than one goroutine.
+func (c *Connection) writeLoop() {
+	defer close(c.closed)
+	defer c.transport.Close()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	ctx := context.Background()
+
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.transport.WriteMessage(ctx, msg); err != nil {
+				log.Context().Tag("rpc").Err(err).Warn("write to connection failed, closing")
+				return
+			}
+		case <-ticker.C:
+			if err := c.transport.Ping(ctx); err != nil {
+				log.Context().Tag("rpc").Err(err).Warn("ping failed, closing connection")
+				return
+			}
+		case timeout := <-c.closing:
+			c.drainPending(timeout)
+			return
+		}
+	}
+}
+
+// readLoop owns c.transport's read side: it blocks on ReadMessage in a loop,
+// handing each inbound frame to onMessage, until the transport errors -
+// most often because the peer disconnected, or because writeLoop closed it
+// out from under a still-blocked read. Either way, that's this connection's
+// only signal that the peer is gone, so it asks the writer goroutine to
+// drain and stop.
+func (c *Connection) readLoop() {
+	ctx := context.Background()
+
+	for {
+		msg, err := c.transport.ReadMessage(ctx)
+		if err != nil {
+			log.Context().Tag("rpc").Err(err).Debug("read from connection failed, closing")
+			c.requestClose(drainTimeout)
+			return
+		}
+
+		if c.onMessage != nil {
+			c.onMessage(c.ID, msg)
+		}
+	}
+}
+
+// drainPending flushes whatever is already buffered in c.send, giving up
+// once timeout has elapsed so one slow write can't block a graceful
+// RemoveConnection forever.
+func (c *Connection) drainPending(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		select {
+		case msg := <-c.send:
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), remaining)
+			err := c.transport.WriteMessage(ctx, msg)
+			cancel()
+			if err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// drain asks the writer goroutine to flush whatever is already queued and
+// stop, waiting up to timeout for it to finish before returning either way.
+func (c *Connection) drain(timeout time.Duration) {
+	c.requestClose(timeout)
+
+	select {
+	case <-c.closed:
+	case <-time.After(timeout):
+	}
+}
+
+// requestClose asks the writer goroutine to drain whatever is already
+// queued and stop. Safe to call more than once - from RemoveConnection or
+// from readLoop noticing a dead peer - only the first call has any effect.
+func (c *Connection) requestClose(timeout time.Duration) {
+	c.closeOnce.Do(func() {
+		c.closing <- timeout
+	})
+}
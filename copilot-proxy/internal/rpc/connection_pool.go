@@ -17,21 +17,18 @@ type ZedVersion struct {
 	Version string
 }
 
-// Connection represents an active client connection
-type Connection struct {
-	ID         ConnectionID
-	UserID     UserID
-	Admin      bool
-	ZedVersion ZedVersion
-	CreatedAt  time.Time
-}
+// MessageHandler processes a single inbound RPC message read from connID's
+// transport. SetMessageHandler registers one on a ConnectionPool; every
+// connection's read loop invokes it for each frame it reads.
+type MessageHandler func(connID ConnectionID, msg []byte)
 
 // ConnectionPool manages active connections between clients and the server
 type ConnectionPool struct {
 	nextConnectionID   ConnectionID
 	connections        map[ConnectionID]*Connection
 	connectionsByUser  map[UserID]map[ConnectionID]struct{}
-	channelSubscribers map[uint64]map[ConnectionID]struct{}
+	channelSubscribers map[uint64]map[ConnectionID]int // connID -> subscriber's role
+	handler            MessageHandler
 	mu                 sync.RWMutex
 }
 
@@ -41,25 +38,34 @@ func NewConnectionPool() *ConnectionPool {
 		nextConnectionID:   1,
 		connections:        make(map[ConnectionID]*Connection),
 		connectionsByUser:  make(map[UserID]map[ConnectionID]struct{}),
-		channelSubscribers: make(map[uint64]map[ConnectionID]struct{}),
+		channelSubscribers: make(map[uint64]map[ConnectionID]int),
 	}
 }
 
-// AddConnection adds a new connection to the pool
-func (p *ConnectionPool) AddConnection(userID UserID, admin bool, zedVersion ZedVersion) ConnectionID {
+// SetMessageHandler registers handler as the callback every connection's
+// read loop invokes for each inbound message. Call this once during setup,
+// before AddConnection starts accepting traffic; connections already added
+// keep whatever handler was registered when they were created.
+func (p *ConnectionPool) SetMessageHandler(handler MessageHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handler = handler
+}
+
+// AddConnection wraps transport in a new Connection, starts its writer and
+// reader goroutines, and registers it in the pool. role is the connection's
+// channel role, used by BroadcastChannel to decide which subscribers
+// receive a given broadcast. Inbound messages the connection reads are
+// dispatched to the pool's registered MessageHandler, if any.
+func (p *ConnectionPool) AddConnection(userID UserID, admin bool, zedVersion ZedVersion, role int, transport Transport) ConnectionID {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	connID := p.nextConnectionID
 	p.nextConnectionID++
 
-	conn := &Connection{
-		ID:         connID,
-		UserID:     userID,
-		Admin:      admin,
-		ZedVersion: zedVersion,
-		CreatedAt:  time.Now(),
-	}
+	conn := newConnection(connID, userID, admin, zedVersion, role, transport, p.handler)
 
 	p.connections[connID] = conn
 
@@ -72,13 +78,18 @@ func (p *ConnectionPool) AddConnection(userID UserID, admin bool, zedVersion Zed
 	return connID
 }
 
-// RemoveConnection removes a connection from the pool
+// RemoveConnection unregisters a connection from the pool and gracefully
+// closes it: the connection stops receiving new Send/BroadcastChannel
+// traffic immediately, then its writer goroutine drains whatever was already
+// queued (up to drainTimeout) before the transport is closed. Draining
+// happens outside p.mu, so one slow client can't stall every other pool
+// operation while it flushes.
 func (p *ConnectionPool) RemoveConnection(connID ConnectionID) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	conn, exists := p.connections[connID]
 	if !exists {
+		p.mu.Unlock()
 		return fmt.Errorf("connection %d not found", connID)
 	}
 
@@ -103,6 +114,9 @@ func (p *ConnectionPool) RemoveConnection(connID ConnectionID) error {
 		}
 	}
 
+	p.mu.Unlock()
+
+	conn.drain(drainTimeout)
 	return nil
 }
 
@@ -132,16 +146,67 @@ func (p *ConnectionPool) UserConnectionIDs(userID UserID) []ConnectionID {
 	return connIDs
 }
 
-// SubscribeToChannel subscribes a connection to a channel
+// SubscribeToChannel subscribes every one of userID's connections to
+// channelID at role, the minimum role BroadcastChannel compares against when
+// deciding whether to deliver a given broadcast to this subscriber.
 func (p *ConnectionPool) SubscribeToChannel(userID UserID, channelID uint64, role int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for connID := range p.connectionsByUser[userID] {
 		if _, exists := p.channelSubscribers[channelID]; !exists {
-			p.channelSubscribers[channelID] = make(map[ConnectionID]struct{})
+			p.channelSubscribers[channelID] = make(map[ConnectionID]int)
+		}
+		p.channelSubscribers[channelID][connID] = role
+	}
+}
+
+// Send queues msg for delivery to connID, returning an error if the
+// connection doesn't exist or its send queue is full.
+func (p *ConnectionPool) Send(connID ConnectionID, msg []byte) error {
+	p.mu.RLock()
+	conn, exists := p.connections[connID]
+	p.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("connection %d not found", connID)
+	}
+
+	if !conn.enqueue(msg) {
+		return fmt.Errorf("connection %d: send queue full or closed", connID)
+	}
+
+	return nil
+}
+
+// BroadcastChannel queues msg for delivery to every connection subscribed to
+// channelID whose role is at least minRole, skipping subscribers below it
+// entirely.
+func (p *ConnectionPool) BroadcastChannel(channelID uint64, msg []byte, minRole int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for connID, role := range p.channelSubscribers[channelID] {
+		if role < minRole {
+			continue
+		}
+
+		if conn, exists := p.connections[connID]; exists {
+			conn.enqueue(msg)
+		}
+	}
+}
+
+// ForEachUserConn calls fn once for each of userID's connections still
+// registered in the pool.
+func (p *ConnectionPool) ForEachUserConn(userID UserID, fn func(*Connection)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for connID := range p.connectionsByUser[userID] {
+		if conn, exists := p.connections[connID]; exists {
+			fn(conn)
 		}
-		p.channelSubscribers[channelID][connID] = struct{}{}
 	}
 }
 
@@ -152,5 +217,5 @@ func (p *ConnectionPool) Reset() {
 
 	p.connections = make(map[ConnectionID]*Connection)
 	p.connectionsByUser = make(map[UserID]map[ConnectionID]struct{})
-	p.channelSubscribers = make(map[uint64]map[ConnectionID]struct{})
+	p.channelSubscribers = make(map[uint64]map[ConnectionID]int)
 }
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"context"
+
+	"nhooyr.io/websocket"
+)
+
+// WebSocketTransport implements Transport over a nhooyr.io/websocket
+// connection. It's the production Transport; tests and other non-network
+// callers can satisfy the interface directly instead.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+}
+
+// NewWebSocketTransport wraps an already-accepted WebSocket connection as a
+// Transport.
+func NewWebSocketTransport(conn *websocket.Conn) *WebSocketTransport {
+	return &WebSocketTransport{conn: conn}
+}
+
+// WriteMessage sends data as a single binary WebSocket frame.
+func (t *WebSocketTransport) WriteMessage(ctx context.Context, data []byte) error {
+	return t.conn.Write(ctx, websocket.MessageBinary, data)
+}
+
+// ReadMessage blocks for the next WebSocket frame and returns its payload.
+func (t *WebSocketTransport) ReadMessage(ctx context.Context) ([]byte, error) {
+	_, data, err := t.conn.Read(ctx)
+	return data, err
+}
+
+// Ping sends a WebSocket ping and waits for the peer's pong.
+func (t *WebSocketTransport) Ping(ctx context.Context) error {
+	return t.conn.Ping(ctx)
+}
+
+// Close closes the connection with a normal closure status.
+func (t *WebSocketTransport) Close() error {
+	return t.conn.Close(websocket.StatusNormalClosure, "connection closed")
+}
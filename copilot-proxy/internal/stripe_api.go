@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/checkout/session"
+	"github.com/stripe/stripe-go/v72/client"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// StripeAPI is the subset of Stripe functionality StripeBilling depends on.
+// Extracting it lets NewStripeBillingWithAPI substitute stripemock.Client in
+// tests instead of talking to live Stripe.
+type StripeAPI interface {
+	ListPrices(params *stripe.PriceListParams) ([]*stripe.Price, error)
+	ListMeters(ctx context.Context) ([]StripeMeter, *APIResponse, error)
+	RecordMeterEvent(ctx context.Context, params MeterEventParams) (*APIResponse, error)
+	CreateCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	ConstructWebhookEvent(payload []byte, signature, secret string) (stripe.Event, error)
+}
+
+// liveStripeAPI implements StripeAPI against the real Stripe API: the SDK
+// client where it covers an endpoint, and MeterEventClient where it doesn't
+// yet (meters and meter events).
+type liveStripeAPI struct {
+	client      *client.API
+	meterEvents *MeterEventClient
+}
+
+// newLiveStripeAPI creates a StripeAPI backed by live Stripe credentials.
+func newLiveStripeAPI(apiKey string) *liveStripeAPI {
+	c := &client.API{}
+	c.Init(apiKey, nil)
+
+	return &liveStripeAPI{
+		client:      c,
+		meterEvents: NewMeterEventClient(apiKey),
+	}
+}
+
+func (a *liveStripeAPI) ListPrices(params *stripe.PriceListParams) ([]*stripe.Price, error) {
+	i := a.client.Prices.List(params)
+	prices := make([]*stripe.Price, 0)
+
+	for i.Next() {
+		prices = append(prices, i.Price())
+	}
+
+	return prices, i.Err()
+}
+
+func (a *liveStripeAPI) ListMeters(ctx context.Context) ([]StripeMeter, *APIResponse, error) {
+	return a.meterEvents.ListMeters(ctx)
+}
+
+func (a *liveStripeAPI) RecordMeterEvent(ctx context.Context, params MeterEventParams) (*APIResponse, error) {
+	return a.meterEvents.RecordEvent(ctx, params)
+}
+
+func (a *liveStripeAPI) CreateCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return session.New(params)
+}
+
+func (a *liveStripeAPI) ConstructWebhookEvent(payload []byte, signature, secret string) (stripe.Event, error) {
+	return webhook.ConstructEvent(payload, signature, secret)
+}
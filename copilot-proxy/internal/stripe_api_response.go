@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+)
+
+// APIResponse captures the raw metadata of a Stripe API response that's
+// useful for production debugging: when a BillModelUsage call fails or looks
+// like it double-charged, operators need the Stripe request ID to open a
+// support ticket.
+type APIResponse struct {
+	StatusCode         int
+	StripeRequestID    string
+	IdempotencyKey     string
+	RateLimitRemaining string
+}
+
+// responseFromHTTP builds an APIResponse from a raw HTTP response, capturing
+// headers before the body is decoded.
+func responseFromHTTP(resp *http.Response, idempotencyKey string) *APIResponse {
+	return &APIResponse{
+		StatusCode:         resp.StatusCode,
+		StripeRequestID:    resp.Header.Get("Stripe-Request-Id"),
+		IdempotencyKey:     idempotencyKey,
+		RateLimitRemaining: resp.Header.Get("X-Ratelimit-Remaining"),
+	}
+}
+
+// idempotencyKeyContextKey is the context key under which WithIdempotencyKey
+// stores a caller-supplied idempotency key.
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey attaches an idempotency key to ctx so that retried
+// billing calls made with the same context are safe to repeat.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// idempotencyKeyFromContext returns the idempotency key previously attached
+// with WithIdempotencyKey, if any.
+func idempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key, ok
+}
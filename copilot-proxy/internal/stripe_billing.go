@@ -1,18 +1,39 @@
 package internal
 
 import (
+	"context"
+	"copilot-proxy/internal/log"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/stripe/stripe-go/v72"
-	"github.com/stripe/stripe-go/v72/client"
+)
+
+// stripeAPIBaseURL, meterEventsPath, and metersPath are declared in
+// stripe_meter_client.go, the file that actually issues requests against
+// them.
+
+// meterEventMaxAttempts and meterEventRetryWait bound the retry of a meter
+// event record after a transient failure. Every attempt reuses the same
+// idempotency key, so Stripe de-dupes any that actually landed.
+const (
+	meterEventMaxAttempts = 3
+	meterEventRetryWait   = 200 * time.Millisecond
 )
 
 // StripeBilling handles interactions with Stripe for billing purposes
 type StripeBilling struct {
-	client *client.API
-	state  *StripeBillingState
-	mu     sync.RWMutex
+	api   StripeAPI
+	state *StripeBillingState
+	mu    sync.RWMutex
+
+	// LastResponse holds the raw metadata (status code, Stripe request ID,
+	// rate-limit headers) from the most recent Stripe API call made through
+	// this client, for use when debugging a failed or double-charged call.
+	LastResponse *APIResponse
 }
 
 // StripeBillingState maintains the internal state of the billing system
@@ -49,31 +70,35 @@ func (c Cents) FromDollars(dollars float64) Cents {
 	return Cents(dollars * 100)
 }
 
-// NewStripeBilling creates a new Stripe billing client
+// NewStripeBilling creates a new Stripe billing client backed by live Stripe
+// credentials.
 func NewStripeBilling(apiKey string) (*StripeBilling, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("stripe API key is required")
 	}
 
-	client := &client.API{}
-	client.Init(apiKey, nil)
+	return NewStripeBillingWithAPI(newLiveStripeAPI(apiKey)), nil
+}
 
+// NewStripeBillingWithAPI creates a StripeBilling backed by an arbitrary
+// StripeAPI implementation, e.g. stripemock.Client in tests.
+func NewStripeBillingWithAPI(api StripeAPI) *StripeBilling {
 	return &StripeBilling{
-		client: client,
+		api: api,
 		state: &StripeBillingState{
 			MetersByEventName: make(map[string]StripeMeter),
 			PriceIDsByMeterID: make(map[string]string),
 		},
-	}, nil
+	}
 }
 
 // Initialize fetches and caches meters and prices from Stripe
-func (s *StripeBilling) Initialize() error {
+func (s *StripeBilling) Initialize(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Fetch meters
-	meters, err := s.listMeters()
+	meters, err := s.listMeters(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list meters: %w", err)
 	}
@@ -98,28 +123,30 @@ func (s *StripeBilling) Initialize() error {
 	return nil
 }
 
-// BillModelUsage bills a customer for usage of an LLM model
-func (s *StripeBilling) BillModelUsage(customerID string, model *StripeModel, event ModelEvent) error {
+// BillModelUsage bills a customer for usage of an LLM model. Pass a context
+// decorated with WithIdempotencyKey to make retries of the same usage event
+// safe.
+func (s *StripeBilling) BillModelUsage(ctx context.Context, customerID string, model *StripeModel, event ModelEvent) error {
 	if event.InputTokens > 0 {
-		if err := s.recordMeterEvent(customerID, model.InputTokensPrice.MeterEventName, event.InputTokens); err != nil {
+		if err := s.recordMeterEvent(ctx, customerID, model.InputTokensPrice.MeterEventName, event.InputTokens, event); err != nil {
 			return err
 		}
 	}
 
 	if event.InputCacheCreationTokens > 0 {
-		if err := s.recordMeterEvent(customerID, model.InputCacheCreationTokensPrice.MeterEventName, event.InputCacheCreationTokens); err != nil {
+		if err := s.recordMeterEvent(ctx, customerID, model.InputCacheCreationTokensPrice.MeterEventName, event.InputCacheCreationTokens, event); err != nil {
 			return err
 		}
 	}
 
 	if event.InputCacheReadTokens > 0 {
-		if err := s.recordMeterEvent(customerID, model.InputCacheReadTokensPrice.MeterEventName, event.InputCacheReadTokens); err != nil {
+		if err := s.recordMeterEvent(ctx, customerID, model.InputCacheReadTokensPrice.MeterEventName, event.InputCacheReadTokens, event); err != nil {
 			return err
 		}
 	}
 
 	if event.OutputTokens > 0 {
-		if err := s.recordMeterEvent(customerID, model.OutputTokensPrice.MeterEventName, event.OutputTokens); err != nil {
+		if err := s.recordMeterEvent(ctx, customerID, model.OutputTokensPrice.MeterEventName, event.OutputTokens, event); err != nil {
 			return err
 		}
 	}
@@ -129,20 +156,30 @@ func (s *StripeBilling) BillModelUsage(customerID string, model *StripeModel, ev
 
 // ModelEvent represents usage of a language model
 type ModelEvent struct {
+	UserID                   uint64
+	Model                    string
 	InputTokens              int64
 	InputCacheCreationTokens int64
 	InputCacheReadTokens     int64
 	OutputTokens             int64
+	Timestamp                time.Time
 }
 
-// listMeters fetches all meters from Stripe
-func (s *StripeBilling) listMeters() ([]StripeMeter, error) {
-	params := &stripe.BillingPortalConfigurationListParams{}
-	params.Limit = stripe.Int64(100)
+// Context implements log.Contexter so billing log lines are tagged with the
+// user and model an event is for.
+func (e ModelEvent) Context() map[string]any {
+	return map[string]any{
+		"user_id": e.UserID,
+		"model":   e.Model,
+	}
+}
 
-	// Note: This is a placeholder since the Stripe Go library doesn't have a direct meters API
-	// In a real implementation, you would use the appropriate Stripe API endpoints
-	return []StripeMeter{}, nil
+// listMeters fetches all billing meters from Stripe via ListMeters, since the
+// Go SDK does not yet expose the meters API.
+func (s *StripeBilling) listMeters(ctx context.Context) ([]StripeMeter, error) {
+	meters, resp, err := s.api.ListMeters(ctx)
+	s.LastResponse = resp
+	return meters, err
 }
 
 // listPrices fetches all prices from Stripe
@@ -150,23 +187,57 @@ func (s *StripeBilling) listPrices() ([]*stripe.Price, error) {
 	params := &stripe.PriceListParams{}
 	params.Limit = stripe.Int64(100)
 
-	i := s.client.Prices.List(params)
-	prices := make([]*stripe.Price, 0)
+	return s.api.ListPrices(params)
+}
 
-	for i.Next() {
-		prices = append(prices, i.Price())
+// recordMeterEvent records a meter event in Stripe, deriving an idempotency
+// key from the user, model, and event timestamp so retried billing calls
+// never double-charge a customer. A key attached to ctx via
+// WithIdempotencyKey overrides the derived one. It errors rather than
+// silently dropping usage if eventName has no meter registered yet, and
+// retries transient failures using that same idempotency key.
+func (s *StripeBilling) recordMeterEvent(ctx context.Context, customerID string, eventName string, value int64, event ModelEvent) error {
+	s.mu.RLock()
+	_, known := s.state.MetersByEventName[eventName]
+	s.mu.RUnlock()
+	if !known {
+		return fmt.Errorf("no Stripe meter registered for event %q; call Initialize or check the StripeModel's price configuration", eventName)
 	}
 
-	return prices, i.Err()
-}
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
 
-// recordMeterEvent records a meter event in Stripe
-func (s *StripeBilling) recordMeterEvent(customerID string, eventName string, value int64) error {
-	// Implementation needed to use these parameters
-	// For now, to avoid unused parameter warnings:
-	if value > 0 && len(customerID) > 0 && len(eventName) > 0 {
-		// This would use Stripe's metering API, which is not directly available in the Go library
-		// We would need to make a custom API request here
+	params := MeterEventParams{
+		EventName:      eventName,
+		StripeCustomer: customerID,
+		Value:          value,
+		IdempotencyKey: MeterEventIdempotencyKey(event.UserID, event.Model, eventName, timestamp),
+		Timestamp:      timestamp,
 	}
-	return nil
+
+	var resp *APIResponse
+	var err error
+	for attempt := 1; attempt <= meterEventMaxAttempts; attempt++ {
+		resp, err = s.api.RecordMeterEvent(ctx, params)
+		s.LastResponse = resp
+		if err == nil {
+			return nil
+		}
+
+		log.Context(event).Tag("stripe").Err(err).Warn(fmt.Sprintf("failed to record meter event (attempt %d/%d)", attempt, meterEventMaxAttempts))
+		if attempt < meterEventMaxAttempts {
+			time.Sleep(meterEventRetryWait)
+		}
+	}
+
+	return err
+}
+
+// MeterEventIdempotencyKey derives a stable idempotency key for a meter event
+// from the user, model, event name, and a timestamp bucketed to the second.
+func MeterEventIdempotencyKey(userID uint64, model string, eventName string, timestamp time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s:%d", userID, model, eventName, timestamp.Unix())))
+	return "meter_" + hex.EncodeToString(sum[:16])
 }
@@ -0,0 +1,109 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+
+	"copilot-proxy/internal"
+	"copilot-proxy/internal/stripemock"
+)
+
+func testModel() *internal.StripeModel {
+	return &internal.StripeModel{
+		InputTokensPrice:              internal.StripeBillingPrice{ID: "price_input", MeterEventName: "input_tokens"},
+		InputCacheCreationTokensPrice: internal.StripeBillingPrice{ID: "price_cache_create", MeterEventName: "cache_creation_tokens"},
+		InputCacheReadTokensPrice:     internal.StripeBillingPrice{ID: "price_cache_read", MeterEventName: "cache_read_tokens"},
+		OutputTokensPrice:             internal.StripeBillingPrice{ID: "price_output", MeterEventName: "output_tokens"},
+	}
+}
+
+// newInitializedBilling returns a StripeBilling backed by mock, with every
+// meter testModel references already registered, so recordMeterEvent
+// doesn't reject them as unknown.
+func newInitializedBilling(t *testing.T, mock *stripemock.Client) *internal.StripeBilling {
+	t.Helper()
+
+	mock.Meters = []internal.StripeMeter{
+		{ID: "meter_input", EventName: "input_tokens"},
+		{ID: "meter_cache_create", EventName: "cache_creation_tokens"},
+		{ID: "meter_cache_read", EventName: "cache_read_tokens"},
+		{ID: "meter_output", EventName: "output_tokens"},
+	}
+
+	billing := internal.NewStripeBillingWithAPI(mock)
+	if err := billing.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return billing
+}
+
+func TestBillModelUsageSkipsZeroTokenDimensions(t *testing.T) {
+	mock := stripemock.NewClient()
+	billing := newInitializedBilling(t, mock)
+
+	event := internal.ModelEvent{
+		UserID:      1,
+		Model:       "claude-3-opus",
+		InputTokens: 100,
+		// InputCacheCreationTokens, InputCacheReadTokens, and OutputTokens
+		// are left at zero.
+	}
+
+	if err := billing.BillModelUsage(context.Background(), "cus_1", testModel(), event); err != nil {
+		t.Fatalf("BillModelUsage: %v", err)
+	}
+
+	calls := mock.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 meter event recorded, got %d: %+v", len(calls), calls)
+	}
+	if calls[0].EventName != "input_tokens" || calls[0].Value != 100 {
+		t.Fatalf("unexpected call recorded: %+v", calls[0])
+	}
+}
+
+func TestBillModelUsageRetriesWithSameIdempotencyKey(t *testing.T) {
+	mock := stripemock.NewClient()
+	billing := newInitializedBilling(t, mock)
+	mock.RecordMeterEventErr = internalTestErrTransient
+
+	event := internal.ModelEvent{UserID: 1, Model: "claude-3-opus", InputTokens: 50}
+
+	err := billing.BillModelUsage(context.Background(), "cus_1", testModel(), event)
+	if err == nil {
+		t.Fatal("expected BillModelUsage to return the persistent RecordMeterEvent error")
+	}
+
+	// meterEventMaxAttempts (3) retries, each deriving the same idempotency
+	// key from the event's user, model, and timestamp - recordMeterEvent
+	// never regenerates a new one between attempts.
+	const meterEventMaxAttempts = 3
+	if got := mock.Attempts(); got != meterEventMaxAttempts {
+		t.Fatalf("expected %d attempts, got %d", meterEventMaxAttempts, got)
+	}
+}
+
+func TestBillModelUsageErrorsOnUnregisteredMeter(t *testing.T) {
+	mock := stripemock.NewClient()
+	// Deliberately skip registering any meters, unlike newInitializedBilling.
+	billing := internal.NewStripeBillingWithAPI(mock)
+	if err := billing.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	event := internal.ModelEvent{UserID: 1, Model: "claude-3-opus", InputTokens: 10}
+
+	if err := billing.BillModelUsage(context.Background(), "cus_1", testModel(), event); err == nil {
+		t.Fatal("expected BillModelUsage to error for a meter not in MetersByEventName")
+	}
+
+	if len(mock.Calls()) != 0 {
+		t.Fatalf("expected no meter event to be recorded, got %d", len(mock.Calls()))
+	}
+}
+
+var internalTestErrTransient = &transientError{}
+
+type transientError struct{}
+
+func (*transientError) Error() string { return "transient stripe error" }
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// stripeAPIBaseURL is the root of Stripe's REST API.
+	stripeAPIBaseURL = "https://api.stripe.com/v1"
+	// meterEventsPath is the billing meter events endpoint, not yet covered by the Go SDK.
+	meterEventsPath = "/billing/meter_events"
+	// metersPath is the billing meters endpoint, not yet covered by the Go SDK.
+	metersPath = "/billing/meters"
+)
+
+// MeterEventClient talks to Stripe's billing meter events API directly over
+// HTTP, since github.com/stripe/stripe-go/v72 does not yet cover it.
+type MeterEventClient struct {
+	apiKey     string
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	lastResponse *APIResponse
+}
+
+// NewMeterEventClient creates a client for recording and listing Stripe
+// billing meters using the given secret API key.
+func NewMeterEventClient(apiKey string) *MeterEventClient {
+	return &MeterEventClient{
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// MeterEventParams are the parameters for recording a single meter event.
+type MeterEventParams struct {
+	EventName      string
+	StripeCustomer string
+	Value          int64
+	IdempotencyKey string
+	Timestamp      time.Time
+}
+
+// LastResponse returns the APIResponse metadata from the most recent call
+// made through this client, or nil if none has completed yet.
+func (c *MeterEventClient) LastResponse() *APIResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastResponse
+}
+
+func (c *MeterEventClient) setLastResponse(resp *APIResponse) {
+	c.mu.Lock()
+	c.lastResponse = resp
+	c.mu.Unlock()
+}
+
+// RecordEvent POSTs a usage event to /v1/billing/meter_events, tagging the
+// request with an idempotency key so retries can't double-bill a customer.
+// If ctx carries a key set via WithIdempotencyKey, it takes precedence over
+// params.IdempotencyKey.
+func (c *MeterEventClient) RecordEvent(ctx context.Context, params MeterEventParams) (*APIResponse, error) {
+	idempotencyKey := params.IdempotencyKey
+	if key, ok := idempotencyKeyFromContext(ctx); ok {
+		idempotencyKey = key
+	}
+
+	form := url.Values{}
+	form.Set("event_name", params.EventName)
+	form.Set("payload[stripe_customer_id]", params.StripeCustomer)
+	form.Set("payload[value]", strconv.FormatInt(params.Value, 10))
+	if !params.Timestamp.IsZero() {
+		form.Set("timestamp", strconv.FormatInt(params.Timestamp.Unix(), 10))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stripeAPIBaseURL+meterEventsPath, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("building meter event request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("recording meter event %q: %w", params.EventName, err)
+	}
+	defer resp.Body.Close()
+
+	apiResp := responseFromHTTP(resp, idempotencyKey)
+	c.setLastResponse(apiResp)
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return apiResp, fmt.Errorf("stripe meter_events returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	return apiResp, nil
+}
+
+// ListMeters fetches all billing meters from /v1/billing/meters.
+func (c *MeterEventClient) ListMeters(ctx context.Context) ([]StripeMeter, *APIResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stripeAPIBaseURL+metersPath, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("building list meters request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing meters: %w", err)
+	}
+	defer resp.Body.Close()
+
+	apiResp := responseFromHTTP(resp, "")
+	c.setLastResponse(apiResp)
+
+	if resp.StatusCode >= 400 {
+		return nil, apiResp, fmt.Errorf("stripe meters returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			ID        string `json:"id"`
+			EventName string `json:"event_name"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, apiResp, fmt.Errorf("decoding meters response: %w", err)
+	}
+
+	meters := make([]StripeMeter, 0, len(body.Data))
+	for _, m := range body.Data {
+		meters = append(meters, StripeMeter{ID: m.ID, EventName: m.EventName})
+	}
+
+	return meters, apiResp, nil
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// Subscription is a user's Stripe subscription state, persisted so the llm
+// package's authorization layer can gate model access without calling Stripe
+// on every request.
+type Subscription struct {
+	UserID               uint64
+	StripeCustomerID     string
+	StripeSubscriptionID string
+	Status               string
+	CurrentPeriodEnd     time.Time
+}
+
+// SubscriptionStore persists subscription state derived from Stripe webhooks.
+type SubscriptionStore interface {
+	UpsertSubscription(sub Subscription) error
+	DeleteSubscription(stripeSubscriptionID string) error
+}
+
+// StripeWebhookHandler verifies and dispatches Stripe webhook events,
+// keeping a SubscriptionStore in sync with the customer's billing state.
+type StripeWebhookHandler struct {
+	webhookSecret string
+	subscriptions SubscriptionStore
+}
+
+// NewStripeWebhookHandler creates a webhook handler that verifies signatures
+// against STRIPE_WEBHOOK_SECRET and writes subscription changes to store.
+func NewStripeWebhookHandler(store SubscriptionStore) *StripeWebhookHandler {
+	return &StripeWebhookHandler{
+		webhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		subscriptions: store,
+	}
+}
+
+// ServeHTTP verifies the Stripe-Signature header and dispatches the event.
+func (h *StripeWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), h.webhookSecret)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid webhook signature: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.dispatch(event); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// dispatch routes a verified Stripe event to the appropriate handler.
+func (h *StripeWebhookHandler) dispatch(event stripe.Event) error {
+	switch event.Type {
+	case "customer.subscription.created", "customer.subscription.updated":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return fmt.Errorf("unmarshaling %s: %w", event.Type, err)
+		}
+		return h.subscriptions.UpsertSubscription(subscriptionFromStripe(sub))
+
+	case "customer.subscription.deleted":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return fmt.Errorf("unmarshaling %s: %w", event.Type, err)
+		}
+		return h.subscriptions.DeleteSubscription(sub.ID)
+
+	case "checkout.session.completed":
+		var checkoutSession stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &checkoutSession); err != nil {
+			return fmt.Errorf("unmarshaling checkout.session.completed: %w", err)
+		}
+		if checkoutSession.Subscription == nil {
+			return nil
+		}
+		return h.subscriptions.UpsertSubscription(Subscription{
+			StripeCustomerID:     checkoutSession.Customer.ID,
+			StripeSubscriptionID: checkoutSession.Subscription.ID,
+			Status:               "active",
+		})
+
+	case "invoice.paid":
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return fmt.Errorf("unmarshaling invoice.paid: %w", err)
+		}
+		if invoice.Subscription == nil {
+			return nil
+		}
+		return h.subscriptions.UpsertSubscription(Subscription{
+			StripeCustomerID:     invoice.Customer.ID,
+			StripeSubscriptionID: invoice.Subscription.ID,
+			Status:               "active",
+		})
+	}
+
+	return nil
+}
+
+// subscriptionFromStripe converts a Stripe subscription object into our
+// persisted Subscription shape.
+func subscriptionFromStripe(sub stripe.Subscription) Subscription {
+	return Subscription{
+		StripeCustomerID:     sub.Customer.ID,
+		StripeSubscriptionID: sub.ID,
+		Status:               string(sub.Status),
+		CurrentPeriodEnd:     time.Unix(sub.CurrentPeriodEnd, 0),
+	}
+}
+
+// CreateCheckoutSession creates a Stripe-hosted checkout session for a
+// StripeModel's subscription price and returns the URL to redirect the user to.
+func (s *StripeBilling) CreateCheckoutSession(customerID, successURL, cancelURL string, model *StripeModel) (string, error) {
+	params := &stripe.CheckoutSessionParams{
+		Customer:   stripe.String(customerID),
+		Mode:       stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SuccessURL: stripe.String(successURL),
+		CancelURL:  stripe.String(cancelURL),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{Price: stripe.String(model.InputTokensPrice.ID)},
+			{Price: stripe.String(model.OutputTokensPrice.ID)},
+		},
+	}
+
+	sess, err := s.api.CreateCheckoutSession(params)
+	if err != nil {
+		return "", fmt.Errorf("creating checkout session: %w", err)
+	}
+
+	return sess.URL, nil
+}
+
+// HandleCreateCheckoutSession is the HTTP handler for POST /billing/checkout.
+// It expects a JSON body of {"customer_id": "...", "success_url": "...", "cancel_url": "..."}
+// and responds with {"url": "..."}.
+func HandleCreateCheckoutSession(billing *StripeBilling, model *StripeModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			CustomerID string `json:"customer_id"`
+			SuccessURL string `json:"success_url"`
+			CancelURL  string `json:"cancel_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		url, err := billing.CreateCheckoutSession(req.CustomerID, req.SuccessURL, req.CancelURL, model)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"url": url})
+	}
+}
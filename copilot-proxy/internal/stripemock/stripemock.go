@@ -0,0 +1,131 @@
+// Package stripemock provides an in-memory fake of internal.StripeAPI for
+// tests that need to exercise StripeBilling without live Stripe credentials.
+package stripemock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"copilot-proxy/internal"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// MeterEventCall records a single RecordMeterEvent invocation.
+type MeterEventCall struct {
+	EventName      string
+	StripeCustomer string
+	Value          int64
+	IdempotencyKey string
+}
+
+// Client is an in-memory fake of internal.StripeAPI. It records every call
+// made through it and lets tests assert on billed quantities per customer
+// per meter.
+type Client struct {
+	mu sync.Mutex
+
+	Prices   []*stripe.Price
+	Meters   []internal.StripeMeter
+	Sessions map[string]*stripe.CheckoutSession
+
+	// RecordMeterEventErr, if set, is returned by every RecordMeterEvent call
+	// instead of recording it, for testing retry and error-handling paths.
+	RecordMeterEventErr error
+
+	calls []MeterEventCall
+	// billed accumulates Value per customer ID per event name, so tests can
+	// assert on total billed quantities without re-summing calls themselves.
+	billed map[string]map[string]int64
+	// attempts counts every RecordMeterEvent invocation, including ones that
+	// returned RecordMeterEventErr, so tests can assert a caller retried.
+	attempts int
+}
+
+// NewClient creates an empty Client ready to be populated with fixtures via
+// its exported fields.
+func NewClient() *Client {
+	return &Client{
+		Sessions: make(map[string]*stripe.CheckoutSession),
+		billed:   make(map[string]map[string]int64),
+	}
+}
+
+// ListPrices returns the fixture prices in Prices, ignoring params.
+func (c *Client) ListPrices(params *stripe.PriceListParams) ([]*stripe.Price, error) {
+	return c.Prices, nil
+}
+
+// ListMeters returns the fixture meters in Meters, ignoring ctx.
+func (c *Client) ListMeters(ctx context.Context) ([]internal.StripeMeter, *internal.APIResponse, error) {
+	return c.Meters, &internal.APIResponse{StatusCode: 200}, nil
+}
+
+// RecordMeterEvent records the call and accumulates its value under
+// params.StripeCustomer and params.EventName, returning RecordMeterEventErr
+// if one is set.
+func (c *Client) RecordMeterEvent(ctx context.Context, params internal.MeterEventParams) (*internal.APIResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts++
+
+	if c.RecordMeterEventErr != nil {
+		return nil, c.RecordMeterEventErr
+	}
+
+	c.calls = append(c.calls, MeterEventCall{
+		EventName:      params.EventName,
+		StripeCustomer: params.StripeCustomer,
+		Value:          params.Value,
+		IdempotencyKey: params.IdempotencyKey,
+	})
+
+	if c.billed[params.StripeCustomer] == nil {
+		c.billed[params.StripeCustomer] = make(map[string]int64)
+	}
+	c.billed[params.StripeCustomer][params.EventName] += params.Value
+
+	return &internal.APIResponse{StatusCode: 200, IdempotencyKey: params.IdempotencyKey}, nil
+}
+
+// CreateCheckoutSession returns the fixture session registered under
+// params.Customer in Sessions, or an error if none was registered.
+func (c *Client) CreateCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	customerID := stripe.StringValue(params.Customer)
+	if sess, ok := c.Sessions[customerID]; ok {
+		return sess, nil
+	}
+	return nil, fmt.Errorf("stripemock: no checkout session fixture registered for customer %q", customerID)
+}
+
+// ConstructWebhookEvent is not used by any fixture yet; it returns an error
+// so tests relying on it fail loudly instead of silently succeeding.
+func (c *Client) ConstructWebhookEvent(payload []byte, signature, secret string) (stripe.Event, error) {
+	return stripe.Event{}, fmt.Errorf("stripemock: ConstructWebhookEvent is not implemented")
+}
+
+// Calls returns every RecordMeterEvent call made through this client, in order.
+func (c *Client) Calls() []MeterEventCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]MeterEventCall(nil), c.calls...)
+}
+
+// BilledQuantity returns the total value recorded for customerID under
+// eventName across every RecordMeterEvent call.
+func (c *Client) BilledQuantity(customerID, eventName string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.billed[customerID][eventName]
+}
+
+// Attempts returns how many times RecordMeterEvent was called, including
+// ones that failed with RecordMeterEventErr, so tests can assert a caller
+// retried the expected number of times.
+func (c *Client) Attempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts
+}
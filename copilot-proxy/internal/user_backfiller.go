@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"context"
+	"copilot-proxy/internal/log"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// initialSecondaryBackoff and maxSecondaryBackoff bound the exponential
+// backoff applied after a GitHub secondary rate limit response.
+const (
+	initialSecondaryBackoff = time.Second
+	maxSecondaryBackoff     = 2 * time.Minute
+)
+
+// UserBackfiller periodically fetches additional user data from GitHub
+// to enrich our database with more user information.
+type UserBackfiller struct {
+	client      *http.Client
+	accessToken string
+	db          Database
+	interval    time.Duration
+
+	rateLimitMu sync.Mutex
+	rateLimit   RateLimitStatus
+
+	backoffMu sync.Mutex
+	backoff   time.Duration
+}
+
+// RateLimitStatus is a snapshot of GitHub's primary rate limit state, as
+// last reported by the X-RateLimit-* response headers.
+type RateLimitStatus struct {
+	Remaining int
+	Reset     time.Time
+}
+
+// Database interface defines methods needed by the user backfiller
+type Database interface {
+	GetUsersNeedingBackfill(limit int) ([]UserToBackfill, error)
+	UpdateUserFromGitHub(userID uint64, userData GitHubUserData) error
+	GetUserETag(userID uint64) (etag string, found bool, err error)
+	SetUserETag(userID uint64, etag string) error
+}
+
+// UserToBackfill represents a user that needs additional data
+type UserToBackfill struct {
+	ID         uint64
+	GitHubID   int
+	GitHubName string
+}
+
+// Context implements log.Contexter so backfill log lines are tagged with
+// the user being processed.
+func (u UserToBackfill) Context() map[string]any {
+	return map[string]any{
+		"user_id":     u.ID,
+		"github_id":   u.GitHubID,
+		"github_name": u.GitHubName,
+	}
+}
+
+// GitHubUserData represents user data from GitHub
+type GitHubUserData struct {
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Company     string    `json:"company"`
+	Blog        string    `json:"blog"`
+	Location    string    `json:"location"`
+	Bio         string    `json:"bio"`
+	TwitterUser string    `json:"twitter_username"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// NewUserBackfiller creates a new user backfiller
+func NewUserBackfiller(db Database, accessToken string) *UserBackfiller {
+	return &UserBackfiller{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		accessToken: accessToken,
+		db:          db,
+		interval:    time.Hour,
+	}
+}
+
+// RateLimitStatus returns GitHub's primary rate limit state as of the most
+// recent response, for monitoring.
+func (b *UserBackfiller) RateLimitStatus() RateLimitStatus {
+	b.rateLimitMu.Lock()
+	defer b.rateLimitMu.Unlock()
+	return b.rateLimit
+}
+
+// Start begins the backfilling process
+func (b *UserBackfiller) Start(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	// Process immediately on start
+	b.processBackfill(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.processBackfill(ctx)
+		}
+	}
+}
+
+// processBackfill processes a batch of users that need backfilling
+func (b *UserBackfiller) processBackfill(ctx context.Context) {
+	users, err := b.db.GetUsersNeedingBackfill(50)
+	if err != nil {
+		log.Context().Tag("backfiller").Err(err).Warn("failed to get users to backfill")
+		return
+	}
+
+	if len(users) == 0 {
+		return // No users to backfill
+	}
+
+	for _, user := range users {
+		if !b.waitForQuota(ctx) {
+			return
+		}
+
+		userData, notModified, err := b.fetchGitHubUserData(ctx, user)
+		if err != nil {
+			log.Context(user).Tag("backfiller").Err(err).Warn("failed to fetch GitHub user data")
+			continue
+		}
+
+		if notModified {
+			continue
+		}
+
+		if err := b.db.UpdateUserFromGitHub(user.ID, userData); err != nil {
+			log.Context(user).Tag("backfiller").Err(err).Warn("failed to update user from GitHub data")
+		}
+	}
+}
+
+// fetchGitHubUserData fetches user data from GitHub API, sending a
+// conditional If-None-Match request when we already have an ETag for the
+// user so an unchanged profile costs nothing against the primary quota.
+func (b *UserBackfiller) fetchGitHubUserData(ctx context.Context, user UserToBackfill) (GitHubUserData, bool, error) {
+	url := fmt.Sprintf("https://api.github.com/user/%d", user.GitHubID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return GitHubUserData{}, false, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+b.accessToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	if etag, found, err := b.db.GetUserETag(user.ID); err == nil && found {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return GitHubUserData{}, false, err
+	}
+	defer resp.Body.Close()
+
+	b.recordRateLimit(resp.Header)
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return GitHubUserData{}, true, nil
+	case resp.StatusCode == http.StatusForbidden && isSecondaryRateLimit(resp):
+		b.waitForSecondaryBackoff(ctx, resp)
+		return GitHubUserData{}, false, fmt.Errorf("GitHub secondary rate limit hit")
+	case resp.StatusCode != http.StatusOK:
+		return GitHubUserData{}, false, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	b.resetSecondaryBackoff()
+
+	var userData GitHubUserData
+	if err := json.NewDecoder(resp.Body).Decode(&userData); err != nil {
+		return GitHubUserData{}, false, err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if err := b.db.SetUserETag(user.ID, etag); err != nil {
+			log.Context(user).Tag("backfiller").Err(err).Warn("failed to persist ETag")
+		}
+	}
+
+	return userData, false, nil
+}
+
+// recordRateLimit updates the tracked RateLimitStatus from GitHub's
+// X-RateLimit-Remaining and X-RateLimit-Reset response headers. Headers that
+// fail to parse (e.g. missing on an error response) leave the prior status
+// untouched.
+func (b *UserBackfiller) recordRateLimit(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	resetUnix, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	b.rateLimitMu.Lock()
+	defer b.rateLimitMu.Unlock()
+	b.rateLimit = RateLimitStatus{Remaining: remaining, Reset: time.Unix(resetUnix, 0)}
+}
+
+// waitForQuota blocks until GitHub's primary rate limit window resets if
+// we've exhausted it, so requests always track GitHub's actual quota rather
+// than a hard-coded per-hour count. Returns false if ctx was canceled while
+// waiting.
+func (b *UserBackfiller) waitForQuota(ctx context.Context) bool {
+	status := b.RateLimitStatus()
+	if status.Remaining > 0 || status.Reset.IsZero() {
+		return true
+	}
+
+	wait := time.Until(status.Reset)
+	if wait <= 0 {
+		return true
+	}
+
+	log.Context().Tag("backfiller").Warn(fmt.Sprintf("GitHub primary rate limit exhausted, waiting %s for reset", wait))
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// isSecondaryRateLimit distinguishes a secondary rate limit 403 (abuse
+// detection, concurrency limits) from a primary quota exhaustion 403, which
+// always reports X-RateLimit-Remaining: 0.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	return resp.Header.Get("X-RateLimit-Remaining") != "0"
+}
+
+// waitForSecondaryBackoff blocks for GitHub's requested Retry-After, or for
+// an exponentially increasing backoff if none is given.
+func (b *UserBackfiller) waitForSecondaryBackoff(ctx context.Context, resp *http.Response) {
+	wait := b.nextSecondaryBackoff()
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		wait = time.Duration(retryAfter) * time.Second
+	}
+
+	log.Context().Tag("backfiller").Warn(fmt.Sprintf("GitHub secondary rate limit hit, backing off for %s", wait))
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(wait):
+	}
+}
+
+func (b *UserBackfiller) nextSecondaryBackoff() time.Duration {
+	b.backoffMu.Lock()
+	defer b.backoffMu.Unlock()
+
+	if b.backoff == 0 {
+		b.backoff = initialSecondaryBackoff
+	} else if b.backoff < maxSecondaryBackoff {
+		b.backoff *= 2
+	}
+
+	return b.backoff
+}
+
+func (b *UserBackfiller) resetSecondaryBackoff() {
+	b.backoffMu.Lock()
+	defer b.backoffMu.Unlock()
+	b.backoff = 0
+}